@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+)
+
+const (
+	// defaultDeletionGracePeriod is how long a deleted account can still be
+	// recovered by logging in.
+	defaultDeletionGracePeriod = 30 * 24 * time.Hour
+	accountPurgeInterval       = time.Hour
+)
+
+// handlerDeleteAccount schedules the caller's account for deletion once
+// the grace period is over and signs it out everywhere. Until then its
+// chirps are hidden, and logging in again cancels the deletion.
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	type response struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+	// Wrong passwords count as failed logins, so a stolen access token
+	// can't be used to guess the password here.
+	account := loginAccount(user.Email)
+	if !cfg.reserveLoginAttempt(w, r, account) {
+		return
+	}
+	if _, err := cfg.passwords.Verify(params.Password, user.HashedPassword); err != nil {
+		respondWithError(w, http.StatusForbidden, "Incorrect password", nil)
+		return
+	}
+	cfg.releaseLoginAttempt(r, account)
+
+	deleteAt := time.Now().UTC().Add(cfg.deletionGracePeriod)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		ID:                  userID,
+		DeletionScheduledAt: sql.NullTime{Time: deleteAt, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	if err := revokeUserAccess(r.Context(), qtx, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+
+	log.Printf("User %s scheduled their account for deletion at %s", userID, deleteAt.Format(time.RFC3339))
+	respondWithJSON(w, http.StatusAccepted, response{DeletionScheduledAt: deleteAt})
+}
+
+// cancelAccountDeletion keeps an account that was scheduled for deletion,
+// because its owner logged in during the grace period.
+func (cfg *apiConfig) cancelAccountDeletion(ctx context.Context, user database.User) error {
+	if !user.DeletionScheduledAt.Valid {
+		return nil
+	}
+	cancelled, err := cfg.db.CancelUserDeletion(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if cancelled > 0 {
+		log.Printf("Cancelled the scheduled deletion of user %s", user.ID)
+	}
+	return nil
+}
+
+// runAccountPurge deletes accounts whose grace period is over, with
+// everything they own, and expired data exports until ctx is done.
+func (cfg *apiConfig) runAccountPurge(ctx context.Context) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := cfg.db.DeleteUsersScheduledBefore(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+			if err != nil {
+				log.Printf("Error deleting accounts: %s", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d account(s) at the end of their grace period", deleted)
+			}
+			if _, err := cfg.db.DeleteExpiredDataExports(ctx); err != nil {
+				log.Printf("Error deleting expired data exports: %s", err)
+			}
+		}
+	}
+}
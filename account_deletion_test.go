@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/SethGK/chirpy/internal/throttle"
+	"github.com/google/uuid"
+)
+
+const testPassword = "correct horse battery staple"
+
+// newTestConfig returns a config backed by db, with cheap password hashing
+// and in-memory login throttling.
+func newTestConfig(t *testing.T, db *fakeDB) *apiConfig {
+	t.Helper()
+	key, err := auth.GenerateSigningKey(auth.AlgEdDSA, time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	hasher, err := auth.NewArgon2idHasher(auth.Argon2idParams{
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	if err != nil {
+		t.Fatalf("NewArgon2idHasher error: %v", err)
+	}
+	conn := db.open()
+	t.Cleanup(func() { conn.Close() })
+	throttleStore := throttle.NewMemoryStore()
+	return &apiConfig{
+		db:                  database.New(conn),
+		dbConn:              conn,
+		jwtKeys:             auth.NewKeyring(key),
+		passwords:           auth.NewPasswords(hasher),
+		passwordPolicy:      auth.DefaultPasswordPolicy,
+		throttleStore:       throttleStore,
+		loginAccounts:       throttle.NewLimiter(throttleStore, "account", accountLoginPolicy),
+		loginAddresses:      throttle.NewLimiter(throttleStore, "address", addressLoginPolicy),
+		deletionGracePeriod: defaultDeletionGracePeriod,
+		dataExportSlots:     make(chan struct{}, maxConcurrentDataExports),
+	}
+}
+
+// addTestUser makes db return an active user with testPassword, and
+// returns the user.
+func addTestUser(t *testing.T, cfg *apiConfig, db *fakeDB) database.User {
+	t.Helper()
+	hashedPassword, err := cfg.passwords.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	now := time.Now().UTC()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          "walt@example.com",
+		HashedPassword: hashedPassword,
+		Handle:         "walt",
+		Role:           auth.RoleUser,
+		Status:         accountActive,
+	}
+	setTestUser(db, user)
+	return user
+}
+
+func setTestUser(db *fakeDB, user database.User) {
+	var deletionScheduledAt driver.Value
+	if user.DeletionScheduledAt.Valid {
+		deletionScheduledAt = user.DeletionScheduledAt.Time
+	}
+	row := []driver.Value{
+		user.ID.String(), user.CreatedAt, user.UpdatedAt, user.Email, user.HashedPassword,
+		user.IsChirpyRed, user.Handle, nil, user.Role, user.Status, user.StatusReason, nil,
+		user.ChirpsHidden, deletionScheduledAt,
+	}
+	db.setRows("GetUserByID", row)
+	db.setRows("GetUserByEmail", row)
+	db.setRows("GetUserAccountStatus", []driver.Value{user.Status, user.StatusReason, nil, deletionScheduledAt})
+}
+
+func sessionToken(t *testing.T, cfg *apiConfig, user database.User) string {
+	t.Helper()
+	token, err := auth.MakeSessionJWT(user.ID, uuid.New(), user.Role, cfg.jwtKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT error: %v", err)
+	}
+	return token
+}
+
+func deleteAccount(cfg *apiConfig, token, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/me", strings.NewReader(`{"password":"`+password+`"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.handlerDeleteAccount(w, req)
+	return w
+}
+
+func TestDeleteAccount(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+
+	w := deleteAccount(cfg, sessionToken(t, cfg, user), testPassword)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	for _, query := range []string{"ScheduleUserDeletion", "COMMIT"} {
+		if !db.ran(query) {
+			t.Errorf("%s wasn't run", query)
+		}
+	}
+}
+
+func TestDeleteAccountWrongPassword(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	token := sessionToken(t, cfg, user)
+
+	w := deleteAccount(cfg, token, "wrong password")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	if db.ran("ScheduleUserDeletion") {
+		t.Error("account was scheduled for deletion with the wrong password")
+	}
+
+	// Guesses are throttled like logins, so they soon stop being checked.
+	throttled := false
+	for i := 0; i < accountLoginPolicy.FreeAttempts+1 && !throttled; i++ {
+		throttled = deleteAccount(cfg, token, "wrong password").Code == http.StatusTooManyRequests
+	}
+	if !throttled {
+		t.Fatal("wrong passwords weren't throttled")
+	}
+	if w := deleteAccount(cfg, token, testPassword); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status with the right password while throttled = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if db.ran("ScheduleUserDeletion") {
+		t.Error("account was scheduled for deletion while throttled")
+	}
+}
+
+func TestLoginCancelsAccountDeletion(t *testing.T) {
+	for _, scheduled := range []bool{false, true} {
+		db := newFakeDB()
+		cfg := newTestConfig(t, db)
+		user := addTestUser(t, cfg, db)
+		if scheduled {
+			user.DeletionScheduledAt.Time = time.Now().UTC().Add(time.Hour)
+			user.DeletionScheduledAt.Valid = true
+			setTestUser(db, user)
+		}
+		now := time.Now().UTC()
+		db.setRows("CreateRefreshToken", []driver.Value{
+			"refresh", now, now, user.ID.String(), now.Add(time.Hour), nil,
+			uuid.NewString(), "", "", now, nil, nil,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/login",
+			strings.NewReader(`{"email":"`+user.Email+`","password":"`+testPassword+`"}`))
+		w := httptest.NewRecorder()
+		cfg.handlerLogin(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("scheduled %v: status = %d, want %d: %s", scheduled, w.Code, http.StatusOK, w.Body)
+		}
+		if got := db.ran("CancelUserDeletion"); got != scheduled {
+			t.Errorf("scheduled %v: deletion cancelled = %v", scheduled, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Account states. Suspensions last until a set time; bans until lifted.
+const (
+	accountActive    = "active"
+	accountSuspended = "suspended"
+	accountBanned    = "banned"
+)
+
+const maxStatusReasonLength = 500
+
+// accountRestriction is the error for a suspended or banned account.
+type accountRestriction struct {
+	Status         string
+	Reason         string
+	SuspendedUntil time.Time
+}
+
+func (e *accountRestriction) Error() string {
+	if e.Status == accountSuspended {
+		return fmt.Sprintf("account is suspended until %s", e.SuspendedUntil.Format(time.RFC3339))
+	}
+	return "account is banned"
+}
+
+// restrictionOf returns the restriction an account with the given state is
+// under at now, or nil if it may be used. Suspensions lapse on their own
+// once their time is up.
+func restrictionOf(status, reason string, suspendedUntil sql.NullTime, now time.Time) *accountRestriction {
+	switch {
+	case status == accountBanned:
+		return &accountRestriction{Status: accountBanned, Reason: reason}
+	case status == accountSuspended && suspendedUntil.Valid && suspendedUntil.Time.After(now):
+		return &accountRestriction{Status: accountSuspended, Reason: reason, SuspendedUntil: suspendedUntil.Time}
+	}
+	return nil
+}
+
+// effectiveStatus is the state an account is in at now, with lapsed
+// suspensions reported as active.
+func effectiveStatus(status string, suspendedUntil sql.NullTime, now time.Time) string {
+	if restriction := restrictionOf(status, "", suspendedUntil, now); restriction != nil {
+		return restriction.Status
+	}
+	return accountActive
+}
+
+// checkAccountStatus returns an *accountRestriction if userID may not use
+// their account right now. It runs on every authenticated request, so a
+// suspension or ban takes effect on tokens that were already issued.
+func (cfg *apiConfig) checkAccountStatus(ctx context.Context, userID uuid.UUID) error {
+	account, err := cfg.db.GetUserAccountStatus(ctx, userID)
+	if err == sql.ErrNoRows {
+		return auth.ErrTokenUnknown
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errTokenLookup, err)
+	}
+	if restriction := restrictionOf(account.Status, account.StatusReason, account.SuspendedUntil, time.Now().UTC()); restriction != nil {
+		return restriction
+	}
+	// Deleting an account ends its sessions; only logging in again, which
+	// cancels the deletion, brings it back.
+	if account.DeletionScheduledAt.Valid {
+		return auth.ErrTokenUnknown
+	}
+	return nil
+}
+
+// hiddenAuthorIDs returns which of userIDs have their chirps hidden from
+// everyone, as the hidden_chirp_authors view decides for chirp listings.
+func (cfg *apiConfig) hiddenAuthorIDs(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	hidden := make(map[uuid.UUID]bool)
+	if len(userIDs) == 0 {
+		return hidden, nil
+	}
+	ids, err := cfg.db.ListHiddenChirpAuthors(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hidden[id] = true
+	}
+	return hidden, nil
+}
+
+// respondAccountRestricted writes a 403 telling the user why their account
+// can't be used and, for suspensions, until when.
+func respondAccountRestricted(w http.ResponseWriter, restriction *accountRestriction) {
+	type response struct {
+		Error          string     `json:"error"`
+		Status         string     `json:"status"`
+		Reason         string     `json:"reason"`
+		SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	}
+
+	resp := response{
+		Error:  "Account is banned",
+		Status: restriction.Status,
+		Reason: restriction.Reason,
+	}
+	if restriction.Status == accountSuspended {
+		resp.Error = "Account is suspended"
+		resp.SuspendedUntil = &restriction.SuspendedUntil
+	}
+	sendJSONResponse(w, resp, http.StatusForbidden)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// AdminUser is a user as staff see them, with their role and standing.
+type AdminUser struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Handle        string    `json:"handle"`
+	Role          string    `json:"role"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	// Status is the account's state now, so lapsed suspensions show as
+	// active.
+	Status         string     `json:"status"`
+	StatusReason   string     `json:"status_reason,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	ChirpsHidden   bool       `json:"chirps_hidden"`
+}
+
+func databaseAdminUser(u database.User) AdminUser {
+	user := AdminUser{
+		ID:            u.ID,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+		Email:         u.Email,
+		Handle:        u.Handle,
+		Role:          u.Role,
+		IsChirpyRed:   u.IsChirpyRed,
+		EmailVerified: u.EmailVerifiedAt.Valid,
+		Status:        effectiveStatus(u.Status, u.SuspendedUntil, time.Now().UTC()),
+	}
+	if user.Status != accountActive {
+		user.StatusReason = u.StatusReason
+		user.ChirpsHidden = u.ChirpsHidden
+	}
+	if user.Status == accountSuspended {
+		user.SuspendedUntil = &u.SuspendedUntil.Time
+	}
+	return user
+}
+
+// canManage reports whether actor may act on target's account. Nobody
+// manages themselves, and only admins manage their peers.
+func canManage(actor, target database.User) bool {
+	if actor.ID == target.ID {
+		return false
+	}
+	return actor.Role == auth.RoleAdmin || !auth.RoleAtLeast(target.Role, actor.Role)
+}
+
+// manageableUser loads the user named in the path for the signed-in staff
+// member to act on. It writes the error response and returns false when
+// the user doesn't exist or is out of the actor's reach.
+func (cfg *apiConfig) manageableUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return database.User{}, false
+	}
+
+	target, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return database.User{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return database.User{}, false
+	}
+
+	if !canManage(requestActor(r), target) {
+		respondWithError(w, http.StatusForbidden, "You can't manage this user", nil)
+		return database.User{}, false
+	}
+	return target, true
+}
+
+// revokeUserAccess signs userID out of every session and OAuth grant and
+// revokes their personal access tokens. Access tokens already issued for
+// sessions stay valid until they expire.
+func revokeUserAccess(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	_, err := q.RevokeOtherUserSessions(ctx, database.RevokeOtherUserSessionsParams{
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	return q.RevokeUserPersonalAccessTokens(ctx, userID)
+}
+
+// handlerAdminListUsers pages through users, newest first, optionally
+// narrowed by a search on email and handle and by role.
+func (cfg *apiConfig) handlerAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, err := parsePageRequest(query, sortDesc, sortAsc)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var search, role sql.NullString
+	if q := strings.TrimSpace(query.Get("search")); q != "" {
+		search = sql.NullString{String: q, Valid: true}
+	}
+	if value := query.Get("role"); value != "" {
+		if !auth.ValidRole(value) {
+			respondWithError(w, http.StatusBadRequest, "role must be one of: "+strings.Join(auth.Roles, ", "), nil)
+			return
+		}
+		role = sql.NullString{String: value, Valid: true}
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+	var rows []database.User
+	if page.descending() {
+		rows, err = cfg.db.ListUsersForAdminDesc(r.Context(), database.ListUsersForAdminDescParams{
+			Search:          search,
+			Role:            role,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+	} else {
+		rows, err = cfg.db.ListUsersForAdminAsc(r.Context(), database.ListUsersForAdminAscParams{
+			Search:          search,
+			Role:            role,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list users", err)
+		return
+	}
+
+	users := make([]AdminUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, databaseAdminUser(row))
+	}
+	users, next, prev := paginate(page, users, func(u AdminUser) pageCursor {
+		return pageCursor{CreatedAt: u.CreatedAt, ID: u.ID}
+	})
+	setPaginationLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// handlerAdminSetRole changes a user's role. Their current access tokens
+// keep the old role claim, but role checks also consult the database.
+func (cfg *apiConfig) handlerAdminSetRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "role must be one of: "+strings.Join(auth.Roles, ", "), nil)
+		return
+	}
+
+	target, ok := cfg.manageableUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   target.ID,
+		Role: params.Role,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't change role", err)
+		return
+	}
+
+	log.Printf("User %s changed the role of user %s from %s to %s", requestActor(r).ID, target.ID, target.Role, user.Role)
+	respondWithJSON(w, http.StatusOK, databaseAdminUser(user))
+}
+
+// accountStatusParameters is the body of a suspension, ban or
+// reinstatement. Until only applies to suspensions, and hiding chirps only
+// to the restrictions.
+type accountStatusParameters struct {
+	Reason     string    `json:"reason"`
+	Until      time.Time `json:"until"`
+	HideChirps bool      `json:"hide_chirps"`
+}
+
+// decodeAccountStatusParameters reads the body of a state change, which
+// must give a reason for the audit trail.
+func decodeAccountStatusParameters(w http.ResponseWriter, r *http.Request) (accountStatusParameters, bool) {
+	var params accountStatusParameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return params, false
+	}
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" || len(params.Reason) > maxStatusReasonLength {
+		respondWithError(w, http.StatusBadRequest, "A reason of at most 500 characters is required", nil)
+		return params, false
+	}
+	return params, true
+}
+
+// setAccountStatus moves target to status and records who did it and why.
+// Restricting an account also ends every session, grant and token it has.
+func (cfg *apiConfig) setAccountStatus(r *http.Request, target database.User, status, reason string, suspendedUntil sql.NullTime, hideChirps bool) (database.User, error) {
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := qtx.SetUserStatus(r.Context(), database.SetUserStatusParams{
+		ID:             target.ID,
+		Status:         status,
+		StatusReason:   reason,
+		SuspendedUntil: suspendedUntil,
+		ChirpsHidden:   hideChirps,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	actor := requestActor(r)
+	err = qtx.CreateAccountStatusEvent(r.Context(), database.CreateAccountStatusEventParams{
+		UserID:         target.ID,
+		ActorID:        uuid.NullUUID{UUID: actor.ID, Valid: true},
+		Status:         status,
+		Reason:         reason,
+		SuspendedUntil: suspendedUntil,
+		ChirpsHidden:   hideChirps,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if status != accountActive {
+		if err := revokeUserAccess(r.Context(), qtx, target.ID); err != nil {
+			return database.User{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.User{}, err
+	}
+
+	log.Printf("User %s set the status of user %s to %s: %s", actor.ID, target.ID, status, reason)
+	return user, nil
+}
+
+// handlerAdminSuspendUser locks a user out until a set time, optionally
+// hiding their chirps from listings meanwhile.
+func (cfg *apiConfig) handlerAdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeAccountStatusParameters(w, r)
+	if !ok {
+		return
+	}
+	if !params.Until.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "until must be a time in the future", nil)
+		return
+	}
+
+	target, ok := cfg.manageableUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.setAccountStatus(r, target, accountSuspended, params.Reason,
+		sql.NullTime{Time: params.Until.UTC(), Valid: true}, params.HideChirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, databaseAdminUser(user))
+}
+
+// handlerAdminBanUser locks a user out until an admin reinstates them.
+func (cfg *apiConfig) handlerAdminBanUser(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeAccountStatusParameters(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := cfg.manageableUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.setAccountStatus(r, target, accountBanned, params.Reason, sql.NullTime{}, params.HideChirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't ban user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, databaseAdminUser(user))
+}
+
+// handlerAdminReinstateUser lifts a suspension or, for admins, a ban, and
+// shows the user's chirps again.
+func (cfg *apiConfig) handlerAdminReinstateUser(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeAccountStatusParameters(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := cfg.manageableUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch effectiveStatus(target.Status, target.SuspendedUntil, time.Now().UTC()) {
+	case accountActive:
+		respondWithError(w, http.StatusConflict, "User is not suspended or banned", nil)
+		return
+	case accountBanned:
+		if requestActor(r).Role != auth.RoleAdmin {
+			respondWithError(w, http.StatusForbidden, "Only admins can lift bans", nil)
+			return
+		}
+	}
+
+	user, err := cfg.setAccountStatus(r, target, accountActive, params.Reason, sql.NullTime{}, false)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reinstate user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, databaseAdminUser(user))
+}
+
+// handlerAdminStatusHistory lists every change to a user's account state,
+// newest first.
+func (cfg *apiConfig) handlerAdminStatusHistory(w http.ResponseWriter, r *http.Request) {
+	type event struct {
+		Status         string     `json:"status"`
+		Reason         string     `json:"reason"`
+		SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+		ChirpsHidden   bool       `json:"chirps_hidden"`
+		ActorID        *uuid.UUID `json:"actor_id"`
+		ActorHandle    string     `json:"actor_handle,omitempty"`
+		CreatedAt      time.Time  `json:"created_at"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	rows, err := cfg.db.ListAccountStatusEvents(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list status history", err)
+		return
+	}
+
+	events := make([]event, 0, len(rows))
+	for _, row := range rows {
+		e := event{
+			Status:       row.Status,
+			Reason:       row.Reason,
+			ChirpsHidden: row.ChirpsHidden,
+			ActorHandle:  row.ActorHandle.String,
+			CreatedAt:    row.CreatedAt,
+		}
+		if row.SuspendedUntil.Valid {
+			e.SuspendedUntil = &row.SuspendedUntil.Time
+		}
+		if row.ActorID.Valid {
+			e.ActorID = &row.ActorID.UUID
+		}
+		events = append(events, e)
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// handlerAdminLogoutUser signs a user out everywhere, as a password reset
+// would, without touching their password.
+func (cfg *apiConfig) handlerAdminLogoutUser(w http.ResponseWriter, r *http.Request) {
+	target, ok := cfg.manageableUser(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := revokeUserAccess(r.Context(), cfg.db.WithTx(tx), target.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	log.Printf("User %s signed out user %s", requestActor(r).ID, target.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bootstrapAdmin promotes the account registered under email to admin, so
+// a fresh deployment has someone who can hand out roles.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context, email string) error {
+	promoted, err := cfg.db.PromoteUserToAdmin(ctx, email)
+	if err != nil {
+		return err
+	}
+	if promoted > 0 {
+		log.Printf("Promoted %s to admin", email)
+	}
+	return nil
+}
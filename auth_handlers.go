@@ -1,7 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
@@ -10,21 +12,24 @@ import (
 	"github.com/google/uuid"
 )
 
+type loginResponse struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Handle        string    `json:"handle"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+}
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
-	type response struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		IsChirpyRed  bool      `json:"is_chirpy_red"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
-	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
@@ -34,19 +39,85 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	account := loginAccount(params.Email)
+	if !cfg.reserveLoginAttempt(w, r, account) {
+		return
+	}
+
 	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	rehash, err := cfg.passwords.Verify(params.Password, user.HashedPassword)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
+	cfg.releaseLoginAttempt(r, account)
+	if restriction := restrictionOf(user.Status, user.StatusReason, user.SuspendedUntil, time.Now().UTC()); restriction != nil {
+		respondAccountRestricted(w, restriction)
+		return
+	}
+	if rehash {
+		cfg.rehashPassword(r, user.ID, params.Password)
+	}
+
+	// With a second factor enrolled the password alone only earns a
+	// challenge token, exchanged for a session at /api/login/mfa.
+	totp, err := cfg.db.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor authentication", err)
+		return
+	}
+	if err == nil && totp.ConfirmedAt.Valid {
+		challenge, err := auth.MakeMFAChallengeJWT(user.ID, cfg.jwtKeys, mfaChallengeDuration)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create MFA challenge", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, mfaChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge,
+		})
+		return
+	}
+
+	cfg.recordLoginSuccess(r, account)
+	cfg.startSession(w, r, user)
+}
+
+// rehashPassword replaces a user's stored hash with one from the current
+// hasher, after a login proved the password. Failure only delays the
+// upgrade to the next login.
+func (cfg *apiConfig) rehashPassword(r *http.Request, userID uuid.UUID, password string) {
+	hashedPassword, err := cfg.passwords.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+	err = cfg.db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             userID,
+	})
+	if err != nil {
+		log.Printf("Error saving rehashed password: %s", err)
+	}
+}
+
+// startSession signs user in on a new session and responds with its access
+// and refresh tokens. Signing in keeps an account that was scheduled for
+// deletion.
+func (cfg *apiConfig) startSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := cfg.cancelAccountDeletion(r.Context(), user); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore account", err)
+		return
+	}
+
+	sessionID := uuid.New()
 
-	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	accessToken, err := auth.MakeSessionJWT(user.ID, sessionID, user.Role, cfg.jwtKeys, time.Hour)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
 		return
@@ -61,21 +132,26 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		UserID:    user.ID,
 		Token:     refreshToken,
-		ExpiresAt: time.Now().UTC().Add(24 * time.Hour), // Set expiry to 24 hours
+		ExpiresAt: time.Now().UTC().Add(refreshTokenDuration),
+		FamilyID:  sessionID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        accessToken,
-		RefreshToken: refreshToken,
+	respondWithJSON(w, http.StatusOK, loginResponse{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Handle:        user.Handle,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Token:         accessToken,
+		RefreshToken:  refreshToken,
 	})
 }
 
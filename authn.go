@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// authenticate validates the caller's bearer access token and returns the
+// user it was issued to. When the token is missing or invalid it writes a
+// 401 with a WWW-Authenticate challenge and returns false, and a 403 when
+// the account is suspended or banned. Only tokens from a signed-in session
+// are accepted; endpoints that delegated tokens may use call authorize
+// instead.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, *auth.Claims, bool) {
+	accessToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return uuid.Nil, nil, false
+	}
+
+	claims, err := auth.ParseJWT(accessToken, cfg.jwtKeys)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return uuid.Nil, nil, false
+	}
+	if !claims.FullAccess() {
+		respondInsufficientScope(w, "")
+		return uuid.Nil, nil, false
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		respondUnauthorized(w, err)
+		return uuid.Nil, nil, false
+	}
+	if err := cfg.checkAccountStatus(r.Context(), userID); err != nil {
+		respondAuthError(w, err)
+		return uuid.Nil, nil, false
+	}
+	return userID, claims, true
+}
+
+// authorize is like authenticate but also accepts personal access tokens,
+// as long as the token was granted scope. A token without it gets a 403.
+func (cfg *apiConfig) authorize(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, *auth.Claims, bool) {
+	accessToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return uuid.Nil, nil, false
+	}
+
+	claims, err := cfg.parseAccessToken(r.Context(), accessToken)
+	if err != nil {
+		respondAuthError(w, err)
+		return uuid.Nil, nil, false
+	}
+	if !claims.HasScope(scope) {
+		respondInsufficientScope(w, scope)
+		return uuid.Nil, nil, false
+	}
+
+	// parseAccessToken has already checked the subject.
+	userID, _ := claims.UserID()
+	return userID, claims, true
+}
+
+// actorContextKey is the context key middlewareRequireRole stores the
+// signed-in user under.
+type actorContextKey struct{}
+
+// middlewareRequireRole only lets signed-in sessions of users holding at
+// least role through. The role claim is checked against the database too,
+// so demoting someone takes effect before their token expires. Handlers
+// behind it get the user from requestActor.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, claims, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if !claims.HasRole(role) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("This endpoint needs the %s role", role), nil)
+			return
+		}
+
+		actor, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err == sql.ErrNoRows {
+			respondUnauthorized(w, auth.ErrTokenUnknown)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check role", err)
+			return
+		}
+		if !auth.RoleAtLeast(actor.Role, role) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("This endpoint needs the %s role", role), nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorContextKey{}, actor)))
+	})
+}
+
+// requestActor returns the user middlewareRequireRole let through.
+func requestActor(r *http.Request) database.User {
+	actor, _ := r.Context().Value(actorContextKey{}).(database.User)
+	return actor
+}
+
+// errTokenLookup wraps database errors from parseAccessToken, which are not
+// the caller's fault.
+var errTokenLookup = errors.New("couldn't look up access token")
+
+// parseAccessToken validates a JWT or personal access token and returns
+// its claims. Personal access tokens get claims carrying their scopes.
+// Tokens issued to OAuth clients are only valid while their grant is, and
+// no token is valid while its user is suspended or banned.
+func (cfg *apiConfig) parseAccessToken(ctx context.Context, accessToken string) (*auth.Claims, error) {
+	claims, err := cfg.parseToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkAccountStatus(ctx, userID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (cfg *apiConfig) parseToken(ctx context.Context, accessToken string) (*auth.Claims, error) {
+	if !auth.IsPersonalAccessToken(accessToken) {
+		claims, err := auth.ParseJWT(accessToken, cfg.jwtKeys)
+		if err != nil || claims.ClientID == "" {
+			return claims, err
+		}
+		session := claims.Session()
+		if !session.Valid {
+			return nil, fmt.Errorf("%w: delegated token without a grant", auth.ErrTokenInvalidClaims)
+		}
+		active, err := cfg.db.IsRefreshTokenFamilyActive(ctx, session.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errTokenLookup, err)
+		}
+		if !active {
+			return nil, auth.ErrTokenUnknown
+		}
+		return claims, nil
+	}
+
+	token, err := cfg.db.GetPersonalAccessTokenByHash(ctx, auth.HashToken(accessToken))
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrTokenUnknown
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTokenLookup, err)
+	}
+
+	if err := cfg.db.TouchPersonalAccessToken(ctx, token.ID); err != nil {
+		log.Printf("Error recording personal access token use: %s", err)
+	}
+
+	claims := &auth.Claims{Scope: strings.Join(token.Scopes, " ")}
+	claims.Subject = token.UserID.String()
+	return claims, nil
+}
+
+// respondAuthError writes the response for an error from parseAccessToken
+// or checkAccountStatus.
+func respondAuthError(w http.ResponseWriter, err error) {
+	var restriction *accountRestriction
+	switch {
+	case errors.As(err, &restriction):
+		respondAccountRestricted(w, restriction)
+	case errors.Is(err, errTokenLookup):
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access token", err)
+	default:
+		respondUnauthorized(w, err)
+	}
+}
+
+// respondUnauthorized writes a 401 describing why authentication failed,
+// with a Bearer challenge as described in RFC 6750.
+func respondUnauthorized(w http.ResponseWriter, err error) {
+	errorCode, message := "invalid_token", "Invalid access token"
+	switch {
+	case errors.Is(err, auth.ErrNoAuthHeaderIncluded):
+		errorCode, message = "", "Missing access token"
+	case errors.Is(err, auth.ErrTokenExpired):
+		message = "Access token has expired"
+	case errors.Is(err, auth.ErrTokenSignatureInvalid):
+		message = "Access token signature is invalid"
+	case errors.Is(err, auth.ErrTokenInvalidClaims):
+		message = "Access token is not valid for this service"
+	case errors.Is(err, auth.ErrTokenMalformed):
+		message = "Access token is malformed"
+	case errors.Is(err, auth.ErrTokenUnknown):
+		message = "Access token is unknown, expired or revoked"
+	default:
+		errorCode, message = "invalid_request", "Malformed authorization header"
+	}
+
+	challenge := `Bearer realm="chirpy"`
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, errorCode, message)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	sendJSONResponse(w, ErrorResponse{Error: message}, http.StatusUnauthorized)
+}
+
+// respondInsufficientScope writes a 403 for a valid token that was not
+// granted scope, with the challenge described in RFC 6750. An empty scope
+// means the endpoint needs a signed-in session.
+func respondInsufficientScope(w http.ResponseWriter, scope string) {
+	message := fmt.Sprintf("Access token lacks the %s scope", scope)
+	challenge := `Bearer realm="chirpy", error="insufficient_scope"`
+	if scope == "" {
+		message = "This endpoint needs a signed-in session, not a delegated token"
+		challenge += fmt.Sprintf(`, error_description=%q`, message)
+	} else {
+		challenge += fmt.Sprintf(`, error_description=%q, scope=%q`, message, scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	sendJSONResponse(w, ErrorResponse{Error: message}, http.StatusForbidden)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// RelatedUser is an entry in the caller's list of blocked or muted users.
+type RelatedUser struct {
+	ID        uuid.UUID `json:"id"`
+	Handle    string    `json:"handle"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// blockedUserIDs returns the users who have blocked the viewer or been
+// blocked by them. Chirps by these users are hidden from the viewer and
+// the viewer's chirps are hidden from them.
+func (cfg *apiConfig) blockedUserIDs(ctx context.Context, viewer uuid.NullUUID) (map[uuid.UUID]bool, error) {
+	blocked := make(map[uuid.UUID]bool)
+	if !viewer.Valid {
+		return blocked, nil
+	}
+	ids, err := cfg.db.ListBlockRelatedUserIDs(ctx, viewer.UUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked, nil
+}
+
+// chirpVisible reports whether viewer may see c, which they may not when a
+// block stands between them and its author or, for a plain rechirp, the
+// author of the chirp it shares, or when that author's chirps are hidden
+// from everyone.
+func (cfg *apiConfig) chirpVisible(ctx context.Context, viewer uuid.NullUUID, c database.Chirp) (bool, error) {
+	blocked, err := cfg.blockedUserIDs(ctx, viewer)
+	if err != nil {
+		return false, err
+	}
+	authors := []uuid.UUID{c.UserID}
+	if c.RechirpOf.Valid {
+		original, err := cfg.db.GetChirp(ctx, c.RechirpOf.UUID)
+		if err != nil {
+			return false, err
+		}
+		authors = append(authors, original.UserID)
+	}
+	hidden, err := cfg.hiddenAuthorIDs(ctx, authors)
+	if err != nil {
+		return false, err
+	}
+	for _, author := range authors {
+		if blocked[author] || hidden[author] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// relationshipTarget authorizes the caller and parses the user they are
+// acting on from the path, writing an error response and returning false
+// when either is invalid.
+func (cfg *apiConfig) relationshipTarget(w http.ResponseWriter, r *http.Request) (userID, targetID uuid.UUID, ok bool) {
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, _, ok = cfg.authorize(w, r, auth.ScopeProfileWrite)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if targetID == userID {
+		http.Error(w, "You cannot do that to yourself", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), targetID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return uuid.Nil, uuid.Nil, false
+		}
+		log.Printf("Error retrieving user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, targetID, true
+}
+
+func (cfg *apiConfig) handlerBlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error blocking user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A block severs the follow relationship in both directions.
+	err = qtx.DeleteFollowsBetween(r.Context(), database.DeleteFollowsBetweenParams{
+		UserID:  userID,
+		OtherID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error removing follows: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error unblocking user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerMuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error muting user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnmuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		log.Printf("Error unmuting user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListBlockedUsers(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing blocked users: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	users := make([]RelatedUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, RelatedUser{ID: row.ID, Handle: row.Handle, CreatedAt: row.BlockedAt})
+	}
+	sendJSONResponse(w, users, http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerGetMutedUsers(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListMutedUsers(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing muted users: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	users := make([]RelatedUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, RelatedUser{ID: row.ID, Handle: row.Handle, CreatedAt: row.MutedAt})
+	}
+	sendJSONResponse(w, users, http.StatusOK)
+}
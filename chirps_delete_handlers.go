@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -27,19 +30,23 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Chirp not found", http.StatusNotFound)
@@ -54,11 +61,58 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = cfg.db.DeleteChirp(r.Context(), chirpID)
+	// Plain rechirps have nothing of their own to show, so they go away with
+	// the original even when it is only tombstoned.
+	err = qtx.DeleteRechirpsOf(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		log.Printf("Error deleting rechirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hasReplies, err := qtx.ChirpHasReplies(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hasQuotes, err := qtx.ChirpHasQuotes(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if hasReplies || hasQuotes {
+		err = tombstoneChirp(r.Context(), qtx, chirpID)
+	} else {
+		err = qtx.DeleteChirp(r.Context(), chirpID)
+	}
 	if err != nil {
+		log.Printf("Error deleting chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing chirp deletion: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// tombstoneChirp blanks a chirp that other chirps reply to or quote and drops
+// everything derived from its body, keeping only the row the thread hangs on.
+func tombstoneChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	if err := q.TombstoneChirp(ctx, chirpID); err != nil {
+		return err
+	}
+	if err := q.DeleteChirpRevisions(ctx, chirpID); err != nil {
+		return err
+	}
+	if err := q.DeleteChirpHashtags(ctx, chirpID); err != nil {
+		return err
+	}
+	return q.DeleteChirpMentions(ctx, chirpID)
+}
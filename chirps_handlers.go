@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
-	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/SethGK/chirpy/internal/auth"
 	"github.com/SethGK/chirpy/internal/database"
 	"github.com/google/uuid"
 )
@@ -17,52 +20,75 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	authorIDstr := r.URL.Query().Get("author_id")
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
 
-	var (
-		dbChirps []database.Chirp
-		err      error
-	)
+	page, err := parsePageRequest(r.URL.Query(), sortAsc, sortDesc)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
 
-	if authorIDstr != "" {
-		authorID, parseErr := uuid.Parse(authorIDstr)
+	var authorID uuid.NullUUID
+	if authorIDstr := r.URL.Query().Get("author_id"); authorIDstr != "" {
+		parsed, parseErr := uuid.Parse(authorIDstr)
 		if parseErr != nil {
 			http.Error(w, "Invalid author_id", http.StatusBadRequest)
 			return
 		}
-		dbChirps, err = cfg.db.GetChirpsByAuthor(r.Context(), authorID)
-	} else {
-		dbChirps, err = cfg.db.GetAllChirps(r.Context())
+		authorID = uuid.NullUUID{UUID: parsed, Valid: true}
 	}
 
+	includeRechirps := true
+	if includeStr := r.URL.Query().Get("include_rechirps"); includeStr != "" {
+		includeRechirps, err = strconv.ParseBool(includeStr)
+		if err != nil {
+			http.Error(w, "Invalid include_rechirps", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var dbChirps []database.Chirp
+	if page.descending() {
+		dbChirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			IncludeRechirps: includeRechirps,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+	} else {
+		dbChirps, err = cfg.db.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			IncludeRechirps: includeRechirps,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+	}
 	if err != nil {
 		log.Printf("Error retrieving chirps: %s", err)
 		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirps"}, http.StatusInternalServerError)
 		return
 	}
 
-	var chirps []Chirp
-	for _, c := range dbChirps {
-		chirps = append(chirps, Chirp{
-			ID:        c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body:      c.Body,
-			UserID:    c.UserID,
-		})
-	}
+	dbChirps, next, prev := paginate(page, dbChirps, databaseChirpCursor)
 
-	sortParam := r.URL.Query().Get("sort")
-	if strings.ToLower(sortParam) == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[j].CreatedAt.Before(chirps[i].CreatedAt)
-		})
-	} else {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-		})
+	chirps, err := cfg.loadChirps(r.Context(), viewer, dbChirps)
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirps"}, http.StatusInternalServerError)
+		return
 	}
 
+	setPaginationLinks(w, r, next, prev)
 	sendJSONResponse(w, chirps, http.StatusOK)
 }
 
@@ -84,7 +110,16 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
 	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err == nil && dbChirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.NotFound(w, r)
@@ -95,13 +130,217 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiChirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+	visible, err := cfg.chirpVisible(r.Context(), viewer, dbChirp)
+	if err != nil {
+		log.Printf("Error checking chirp visibility: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirp"}, http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+
+	chirp, err := cfg.loadChirp(r.Context(), viewer, dbChirp)
+	if err != nil {
+		log.Printf("Error loading chirp: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirp"}, http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, chirp, http.StatusOK)
+}
+
+func chirpFromDatabase(c database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserID:    c.UserID,
+		Hashtags:  extractHashtags(c.Body),
+		Deleted:   c.DeletedAt.Valid,
+	}
+	if c.InReplyTo.Valid {
+		chirp.InReplyTo = &c.InReplyTo.UUID
+	}
+	if c.RechirpOf.Valid {
+		chirp.RechirpOf = &c.RechirpOf.UUID
+	}
+	if c.QuoteOf.Valid {
+		chirp.QuoteOf = &c.QuoteOf.UUID
+	}
+	return chirp
+}
+
+// loadChirps converts database chirps into API chirps, fetching the
+// entities stored alongside them in one query per kind rather than per chirp.
+// Rechirps and quotes get the chirp they share embedded as Original.
+// LikedByMe is filled in for viewer when one is given.
+func (cfg *apiConfig) loadChirps(ctx context.Context, viewer uuid.NullUUID, dbChirps []database.Chirp) ([]Chirp, error) {
+	chirps, err := cfg.loadChirpsWithoutOriginals(ctx, viewer, dbChirps)
+	if err != nil {
+		return nil, err
+	}
+
+	var originalIDs []uuid.UUID
+	for _, c := range dbChirps {
+		if id, ok := sharedChirpID(c); ok {
+			originalIDs = append(originalIDs, id)
+		}
+	}
+	if len(originalIDs) == 0 {
+		return chirps, nil
+	}
+
+	dbOriginals, err := cfg.db.GetChirpsByIDs(ctx, originalIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Originals by users in a block with the viewer, or whose chirps are
+	// hidden, are not embedded. Quotes of them are still shown, but plain
+	// rechirps are dropped.
+	blocked, err := cfg.blockedUserIDs(ctx, viewer)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]uuid.UUID, 0, len(dbOriginals))
+	for _, c := range dbOriginals {
+		authors = append(authors, c.UserID)
+	}
+	hidden, err := cfg.hiddenAuthorIDs(ctx, authors)
+	if err != nil {
+		return nil, err
+	}
+	visible := dbOriginals[:0]
+	for _, c := range dbOriginals {
+		if !blocked[c.UserID] && !hidden[c.UserID] {
+			visible = append(visible, c)
+		}
+	}
+
+	originals, err := cfg.loadChirpsWithoutOriginals(ctx, viewer, visible)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*Chirp, len(originals))
+	for i := range originals {
+		byID[originals[i].ID] = &originals[i]
+	}
+
+	kept := chirps[:0]
+	for i, c := range dbChirps {
+		if id, ok := sharedChirpID(c); ok {
+			chirps[i].Original = byID[id]
+			if c.RechirpOf.Valid && chirps[i].Original == nil {
+				continue
+			}
+		}
+		kept = append(kept, chirps[i])
+	}
+	return kept, nil
+}
+
+// sharedChirpID returns the chirp that c rechirps or quotes, if any.
+func sharedChirpID(c database.Chirp) (uuid.UUID, bool) {
+	if c.RechirpOf.Valid {
+		return c.RechirpOf.UUID, true
+	}
+	if c.QuoteOf.Valid {
+		return c.QuoteOf.UUID, true
+	}
+	return uuid.Nil, false
+}
+
+func (cfg *apiConfig) loadChirpsWithoutOriginals(ctx context.Context, viewer uuid.NullUUID, dbChirps []database.Chirp) ([]Chirp, error) {
+	ids := make([]uuid.UUID, 0, len(dbChirps))
+	for _, c := range dbChirps {
+		ids = append(ids, c.ID)
+	}
+
+	mentions, err := cfg.db.GetMentionsForChirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make(map[uuid.UUID]map[string]uuid.UUID)
+	for _, m := range mentions {
+		if resolved[m.ChirpID] == nil {
+			resolved[m.ChirpID] = make(map[string]uuid.UUID)
+		}
+		resolved[m.ChirpID][m.Handle] = m.UserID
+	}
+
+	likeCounts, err := cfg.db.GetLikeCountsForChirps(ctx, ids)
+	if err != nil {
+		return nil, err
 	}
+	likes := make(map[uuid.UUID]int64, len(likeCounts))
+	for _, lc := range likeCounts {
+		likes[lc.ChirpID] = lc.LikeCount
+	}
+
+	liked := make(map[uuid.UUID]bool)
+	if viewer.Valid {
+		likedIDs, err := cfg.db.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+			UserID:   viewer.UUID,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+	}
+
+	chirps := make([]Chirp, 0, len(dbChirps))
+	for _, c := range dbChirps {
+		chirp := chirpFromDatabase(c)
+		chirp.Mentions = mentionEntities(c.Body, resolved[c.ID])
+		chirp.LikeCount = likes[c.ID]
+		chirp.LikedByMe = liked[c.ID]
+		chirps = append(chirps, chirp)
+	}
+	return chirps, nil
+}
+
+func (cfg *apiConfig) loadChirp(ctx context.Context, viewer uuid.NullUUID, dbChirp database.Chirp) (Chirp, error) {
+	chirps, err := cfg.loadChirps(ctx, viewer, []database.Chirp{dbChirp})
+	if err != nil {
+		return Chirp{}, err
+	}
+	if len(chirps) == 0 {
+		return Chirp{}, sql.ErrNoRows
+	}
+	return chirps[0], nil
+}
+
+// optionalViewer identifies the caller of an endpoint that works without
+// authentication. It returns a null ID when no bearer token is sent and an
+// error when the token sent is not valid or lacks the chirps:read scope.
+func (cfg *apiConfig) optionalViewer(r *http.Request) (uuid.NullUUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, nil
+	}
+	accessToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	claims, err := cfg.parseAccessToken(r.Context(), accessToken)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	if !claims.HasScope(auth.ScopeChirpsRead) {
+		return uuid.NullUUID{}, fmt.Errorf("%w: missing the %s scope", auth.ErrTokenInvalidClaims, auth.ScopeChirpsRead)
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}, nil
+}
 
-	sendJSONResponse(w, apiChirp, http.StatusOK)
+func databaseChirpCursor(c database.Chirp) pageCursor {
+	return pageCursor{CreatedAt: c.CreatedAt, ID: c.ID}
 }
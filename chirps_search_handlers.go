@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ChirpSearchResult is a chirp matched by a search along with its relevance.
+type ChirpSearchResult struct {
+	Chirp
+	Rank float32 `json:"rank"`
+}
+
+// searchChirpsRow is the shape shared by every Search* query row.
+type searchChirpsRow struct {
+	Chirp database.Chirp
+	Rank  float32
+}
+
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		sendJSONResponse(w, ErrorResponse{Error: "q is required"}, http.StatusBadRequest)
+		return
+	}
+
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	page, err := parsePageRequest(query, sortRelevance, sortAsc, sortDesc)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	var authorID uuid.NullUUID
+	if authorIDstr := query.Get("author_id"); authorIDstr != "" {
+		parsed, parseErr := uuid.Parse(authorIDstr)
+		if parseErr != nil {
+			http.Error(w, "Invalid author_id", http.StatusBadRequest)
+			return
+		}
+		authorID = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+
+	since, err := parseSearchTime(query, "since")
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	until, err := parseSearchTime(query, "until")
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	rows, err := cfg.searchChirps(r, page, q, authorID, since, until, viewer)
+	if err != nil {
+		log.Printf("Error searching chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to search chirps"}, http.StatusInternalServerError)
+		return
+	}
+
+	rows, next, prev := paginate(page, rows, func(row searchChirpsRow) pageCursor {
+		return pageCursor{CreatedAt: row.Chirp.CreatedAt, ID: row.Chirp.ID, Rank: row.Rank}
+	})
+
+	dbChirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		dbChirps = append(dbChirps, row.Chirp)
+	}
+	chirps, err := cfg.loadChirps(r.Context(), viewer, dbChirps)
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to search chirps"}, http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]ChirpSearchResult, 0, len(rows))
+	for i, row := range rows {
+		results = append(results, ChirpSearchResult{
+			Chirp: chirps[i],
+			Rank:  row.Rank,
+		})
+	}
+
+	setPaginationLinks(w, r, next, prev)
+	sendJSONResponse(w, results, http.StatusOK)
+}
+
+// searchChirps runs the Search* query matching the page's sort order and
+// scan direction. sqlc generates a distinct row type per query, so the rows
+// are copied into searchChirpsRow to give the handler a single type.
+func (cfg *apiConfig) searchChirps(r *http.Request, page pageRequest, q string, authorID uuid.NullUUID, since, until sql.NullTime, viewer uuid.NullUUID) ([]searchChirpsRow, error) {
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var rows []searchChirpsRow
+	switch {
+	case page.Sort == sortRelevance && page.descending():
+		dbRows, err := cfg.db.SearchChirpsByRank(r.Context(), database.SearchChirpsByRankParams{
+			Query:           q,
+			AuthorID:        authorID,
+			Since:           since,
+			Until:           until,
+			CursorRank:      page.cursorRank(),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, searchChirpsRow(row))
+		}
+	case page.Sort == sortRelevance:
+		dbRows, err := cfg.db.SearchChirpsByRankReverse(r.Context(), database.SearchChirpsByRankReverseParams{
+			Query:           q,
+			AuthorID:        authorID,
+			Since:           since,
+			Until:           until,
+			CursorRank:      page.cursorRank(),
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, searchChirpsRow(row))
+		}
+	case page.descending():
+		dbRows, err := cfg.db.SearchChirpsDesc(r.Context(), database.SearchChirpsDescParams{
+			Query:           q,
+			AuthorID:        authorID,
+			Since:           since,
+			Until:           until,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, searchChirpsRow(row))
+		}
+	default:
+		dbRows, err := cfg.db.SearchChirpsAsc(r.Context(), database.SearchChirpsAscParams{
+			Query:           q,
+			AuthorID:        authorID,
+			Since:           since,
+			Until:           until,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range dbRows {
+			rows = append(rows, searchChirpsRow(row))
+		}
+	}
+
+	return rows, nil
+}
+
+// parseSearchTime accepts either a full RFC 3339 timestamp or a plain
+// YYYY-MM-DD date for the since/until filters.
+func parseSearchTime(query url.Values, name string) (sql.NullTime, error) {
+	value := query.Get(name)
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+		}
+	}
+	return sql.NullTime{}, errors.New(name + " must be an RFC 3339 timestamp or YYYY-MM-DD date")
+}
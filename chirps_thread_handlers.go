@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxThreadAncestors    = 100
+	defaultThreadDepth    = 5
+	maxThreadDepth        = 20
+	defaultThreadReplies  = 200
+	maxThreadRepliesLimit = 500
+)
+
+// ThreadReply is a reply in a conversation tree along with its own replies.
+type ThreadReply struct {
+	Chirp
+	Replies []*ThreadReply `json:"replies"`
+}
+
+type ThreadResponse struct {
+	// Ancestors runs from the root of the conversation down to the parent
+	// of Chirp.
+	Ancestors []Chirp        `json:"ancestors"`
+	Chirp     Chirp          `json:"chirp"`
+	Replies   []*ThreadReply `json:"replies"`
+	// Truncated is set when the reply tree hit the limit parameter and
+	// some replies were left out.
+	Truncated bool `json:"truncated"`
+}
+
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	depth, err := parseThreadParam(r, "depth", defaultThreadDepth, maxThreadDepth)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	limit, err := parseThreadParam(r, "limit", defaultThreadReplies, maxThreadRepliesLimit)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	dbChirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error retrieving chirp: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+
+	visible, err := cfg.chirpVisible(r.Context(), viewer, dbChirp)
+	if err != nil {
+		log.Printf("Error checking chirp visibility: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+	blocked, err := cfg.blockedUserIDs(r.Context(), viewer)
+	if err != nil {
+		log.Printf("Error retrieving blocks: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+
+	ancestorRows, err := cfg.db.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ChirpID:  chirpID,
+		MaxDepth: maxThreadAncestors,
+	})
+	if err != nil {
+		log.Printf("Error retrieving thread ancestors: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+
+	descendantRows, err := cfg.db.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+		ChirpID:  uuid.NullUUID{UUID: chirpID, Valid: true},
+		MaxDepth: int32(depth),
+		// One extra row tells us whether the limit cut anything off.
+		Limit: int32(limit) + 1,
+	})
+	if err != nil {
+		log.Printf("Error retrieving thread replies: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+	truncated := len(descendantRows) > limit
+	if truncated {
+		descendantRows = descendantRows[:limit]
+	}
+
+	// Chirps by authors whose chirps are hidden from everyone are treated
+	// like those by blocked users.
+	authors := make([]uuid.UUID, 0, len(ancestorRows)+len(descendantRows))
+	for _, row := range ancestorRows {
+		authors = append(authors, row.UserID)
+	}
+	for _, row := range descendantRows {
+		authors = append(authors, row.UserID)
+	}
+	hidden, err := cfg.hiddenAuthorIDs(r.Context(), authors)
+	if err != nil {
+		log.Printf("Error checking hidden authors: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+	for id := range hidden {
+		blocked[id] = true
+	}
+
+	// Load every chirp in the thread in one batch: ancestors, the chirp
+	// itself, then the replies in breadth-first order. Ancestors by blocked
+	// users become tombstones so the chain stays connected, while their
+	// replies are left out and buildReplyTree drops the replies under them.
+	dbChirps := make([]database.Chirp, 0, len(ancestorRows)+1+len(descendantRows))
+	for _, row := range ancestorRows {
+		if blocked[row.UserID] {
+			row.Body = ""
+			row.DeletedAt = sql.NullTime{Time: row.UpdatedAt, Valid: true}
+		}
+		dbChirps = append(dbChirps, database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			DeletedAt: row.DeletedAt,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		})
+	}
+	dbChirps = append(dbChirps, dbChirp)
+	for _, row := range descendantRows {
+		if blocked[row.UserID] {
+			continue
+		}
+		dbChirps = append(dbChirps, database.Chirp{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			DeletedAt: row.DeletedAt,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		})
+	}
+
+	chirps, err := cfg.loadChirps(r.Context(), viewer, dbChirps)
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve thread"}, http.StatusInternalServerError)
+		return
+	}
+
+	ancestors := chirps[:len(ancestorRows)]
+	chirp := chirps[len(ancestorRows)]
+	replies := chirps[len(ancestorRows)+1:]
+
+	sendJSONResponse(w, ThreadResponse{
+		Ancestors: ancestors,
+		Chirp:     chirp,
+		Replies:   buildReplyTree(chirp.ID, replies),
+		Truncated: truncated,
+	}, http.StatusOK)
+}
+
+// buildReplyTree nests replies under their parents. replies must be in
+// breadth-first order so every parent is seen before its children.
+func buildReplyTree(rootID uuid.UUID, replies []Chirp) []*ThreadReply {
+	root := &ThreadReply{Replies: []*ThreadReply{}}
+	nodes := map[uuid.UUID]*ThreadReply{rootID: root}
+	for _, reply := range replies {
+		if reply.InReplyTo == nil {
+			continue
+		}
+		parent, ok := nodes[*reply.InReplyTo]
+		if !ok {
+			continue
+		}
+		node := &ThreadReply{Chirp: reply, Replies: []*ThreadReply{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[reply.ID] = node
+	}
+	return root.Replies
+}
+
+func parseThreadParam(r *http.Request, name string, def, maxValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return min(n, maxValue), nil
+}
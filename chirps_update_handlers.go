@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type UpdateChirpRequest struct {
+	Body string `json:"body"`
+}
+
+// ChirpRevision is a previous body of an edited chirp. CreatedAt is when that
+// body was written and ReplacedAt is when an edit superseded it.
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+	// Editing is chirping too, or unverified users could rewrite old chirps.
+	if !cfg.requireVerifiedEmail(w, r, userID, restrictChirp) {
+		return
+	}
+
+	var req UpdateChirpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding JSON: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Body) > maxChirpLength {
+		sendJSONResponse(w, ErrorResponse{Error: "Chirp is too long"}, http.StatusBadRequest)
+		return
+	}
+
+	cleanedBody := cleanChirpBody(req.Body)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Lock the row so concurrent edits can't both record the same prior body.
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpID)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Chirp not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if chirp.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if chirp.RechirpOf.Valid {
+		sendJSONResponse(w, ErrorResponse{Error: "Rechirps cannot be edited"}, http.StatusBadRequest)
+		return
+	}
+
+	if chirp.Body != cleanedBody {
+		_, err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+			ChirpID:   chirp.ID,
+			Body:      chirp.Body,
+			CreatedAt: chirp.UpdatedAt,
+		})
+		if err != nil {
+			log.Printf("Error recording chirp revision: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			Body: cleanedBody,
+			ID:   chirp.ID,
+		})
+		if err != nil {
+			log.Printf("Error updating chirp: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := indexChirpHashtags(r.Context(), qtx, chirp); err != nil {
+			log.Printf("Error indexing chirp hashtags: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := indexChirpMentions(r.Context(), qtx, chirp); err != nil {
+			log.Printf("Error indexing chirp mentions: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing chirp update: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	apiChirp, err := cfg.loadChirp(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, chirp)
+	if err != nil {
+		log.Printf("Error loading chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, apiChirp, http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error retrieving chirp: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirp"}, http.StatusInternalServerError)
+		return
+	}
+
+	// The edit history is only visible to those who can see the chirp.
+	visible, err := cfg.chirpVisible(r.Context(), viewer, chirp)
+	if err != nil {
+		log.Printf("Error checking chirp visibility: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirp"}, http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+
+	dbRevisions, err := cfg.db.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error retrieving chirp revisions: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve revisions"}, http.StatusInternalServerError)
+		return
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, rev := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			ID:         rev.ID,
+			ChirpID:    rev.ChirpID,
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+
+	sendJSONResponse(w, revisions, http.StatusOK)
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// exportSyncMaxChirps is the most chirps an account can have for its
+	// export to be built while the request waits. Bigger accounts get a
+	// background export to collect later.
+	exportSyncMaxChirps = 1000
+	dataExportDuration  = 7 * 24 * time.Hour
+	// dataExportReuseWindow is how long a background export, even a
+	// failed one, is handed back instead of starting another one.
+	dataExportReuseWindow = time.Hour
+	dataExportRetryAfter  = 30 * time.Second
+	// maxConcurrentDataExports bounds the exports being built at once,
+	// in the background or not, as each holds its whole archive in memory.
+	maxConcurrentDataExports = 2
+	dataExportTimeout        = 10 * time.Minute
+)
+
+// Background export states.
+const (
+	exportPending = "pending"
+	exportReady   = "ready"
+	exportFailed  = "failed"
+)
+
+// DataExport is a background export of a user's data. Once ready, the
+// archive is downloaded from URL until the export expires.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	URL         string     `json:"url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+func databaseDataExport(e database.GetLatestDataExportRow) DataExport {
+	export := DataExport{
+		ID:        e.ID,
+		Status:    e.Status,
+		URL:       "/api/users/me/exports/" + e.ID.String(),
+		CreatedAt: e.CreatedAt,
+		ExpiresAt: e.ExpiresAt,
+	}
+	if e.CompletedAt.Valid {
+		export.CompletedAt = &e.CompletedAt.Time
+	}
+	return export
+}
+
+// handlerExportData sends the caller a zip of JSON files holding their
+// profile, chirps, likes, relationships and sessions. Large accounts are
+// exported in the background: the response is a 202 pointing at the
+// export, which handlerGetDataExport serves once it is ready.
+func (cfg *apiConfig) handlerExportData(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := cfg.db.CountUserChirps(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+		return
+	}
+	if count <= exportSyncMaxChirps {
+		if !cfg.takeDataExportSlot(w) {
+			return
+		}
+		archive, err := cfg.buildDataExport(r.Context(), userID)
+		<-cfg.dataExportSlots
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+			return
+		}
+		sendExportArchive(w, archive, time.Now().UTC())
+		return
+	}
+
+	// The user stays locked until the new export is committed, so parallel
+	// requests see it instead of each starting their own.
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.LockUserDataExports(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+		return
+	}
+	latest, err := qtx.GetLatestDataExport(r.Context(), userID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+		return
+	}
+	if age := time.Now().UTC().Sub(latest.CreatedAt); err == nil && age < dataExportReuseWindow {
+		if latest.Status == exportFailed {
+			retryAfter := int(math.Ceil((dataExportReuseWindow - age).Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			respondWithJSON(w, http.StatusOK, databaseDataExport(latest))
+			return
+		}
+		respondExportAccepted(w, databaseDataExport(latest))
+		return
+	}
+
+	if !cfg.takeDataExportSlot(w) {
+		return
+	}
+	created, err := qtx.CreateDataExport(r.Context(), database.CreateDataExportParams{
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(dataExportDuration),
+	})
+	if err != nil {
+		<-cfg.dataExportSlots
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		<-cfg.dataExportSlots
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export data", err)
+		return
+	}
+
+	go cfg.runDataExport(r.Context(), created.ID, userID)
+
+	respondExportAccepted(w, databaseDataExport(database.GetLatestDataExportRow(created)))
+}
+
+// handlerGetDataExport downloads a finished background export, or reports
+// on one that isn't.
+func (cfg *apiConfig) handlerGetDataExport(w http.ResponseWriter, r *http.Request) {
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID", err)
+		return
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := cfg.db.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: userID,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Export not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve export", err)
+		return
+	}
+
+	status := databaseDataExport(database.GetLatestDataExportRow{
+		ID:          export.ID,
+		UserID:      export.UserID,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	})
+	switch export.Status {
+	case exportReady:
+		sendExportArchive(w, export.Archive, export.CompletedAt.Time)
+	case exportPending:
+		respondExportAccepted(w, status)
+	default:
+		respondWithJSON(w, http.StatusOK, status)
+	}
+}
+
+// takeDataExportSlot takes one of the maxConcurrentDataExports slots,
+// which the caller frees once its archive is built. When none is free it
+// answers 503 and reports false.
+func (cfg *apiConfig) takeDataExportSlot(w http.ResponseWriter) bool {
+	select {
+	case cfg.dataExportSlots <- struct{}{}:
+		return true
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(int(dataExportRetryAfter.Seconds())))
+		respondWithError(w, http.StatusServiceUnavailable, "Too many exports are running, try again later", nil)
+		return false
+	}
+}
+
+func respondExportAccepted(w http.ResponseWriter, export DataExport) {
+	w.Header().Set("Location", export.URL)
+	w.Header().Set("Retry-After", strconv.Itoa(int(dataExportRetryAfter.Seconds())))
+	respondWithJSON(w, http.StatusAccepted, export)
+}
+
+func sendExportArchive(w http.ResponseWriter, archive []byte, createdAt time.Time) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, createdAt.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// runDataExport builds a background export and stores the result, giving
+// up after dataExportTimeout. It runs past the request that started it and
+// frees the export slot that request took when done.
+func (cfg *apiConfig) runDataExport(ctx context.Context, exportID, userID uuid.UUID) {
+	defer func() { <-cfg.dataExportSlots }()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dataExportTimeout)
+	defer cancel()
+
+	archive, err := cfg.buildDataExport(ctx, userID)
+	if err != nil {
+		log.Printf("Error exporting data for user %s: %s", userID, err)
+		// Record the failure even if it was the timeout that caused it.
+		if err := cfg.db.FailDataExport(context.WithoutCancel(ctx), exportID); err != nil {
+			log.Printf("Error recording failed data export: %s", err)
+		}
+		return
+	}
+
+	err = cfg.db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:      exportID,
+		Archive: archive,
+	})
+	if err != nil {
+		log.Printf("Error saving data export: %s", err)
+	}
+}
+
+type exportProfile struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Handle        string    `json:"handle"`
+	EmailVerified bool      `json:"email_verified"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Role          string    `json:"role"`
+	Status        string    `json:"status"`
+}
+
+type exportChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	RechirpOf *uuid.UUID `json:"rechirp_of"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
+}
+
+type exportLike struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type exportRelationships struct {
+	Following []FollowListUser `json:"following"`
+	Followers []FollowListUser `json:"followers"`
+	Blocked   []RelatedUser    `json:"blocked"`
+	Muted     []RelatedUser    `json:"muted"`
+}
+
+type exportSessions struct {
+	Sessions             []Session             `json:"sessions"`
+	PersonalAccessTokens []PersonalAccessToken `json:"personal_access_tokens"`
+	AuthorizedApps       []OAuthConsent        `json:"authorized_apps"`
+}
+
+// buildDataExport collects everything stored about userID into a zip of
+// JSON files. Secrets, such as password hashes and tokens, are left out.
+func (cfg *apiConfig) buildDataExport(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	user, err := cfg.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	profile := exportProfile{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Handle:        user.Handle,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		Status:        effectiveStatus(user.Status, user.SuspendedUntil, time.Now().UTC()),
+	}
+
+	chirpRows, err := cfg.db.ListUserChirpsForExport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chirps := make([]exportChirp, 0, len(chirpRows))
+	for _, c := range chirpRows {
+		chirp := exportChirp{
+			ID:        c.ID,
+			CreatedAt: c.CreatedAt,
+			UpdatedAt: c.UpdatedAt,
+			Body:      c.Body,
+		}
+		if c.InReplyTo.Valid {
+			chirp.InReplyTo = &c.InReplyTo.UUID
+		}
+		if c.RechirpOf.Valid {
+			chirp.RechirpOf = &c.RechirpOf.UUID
+		}
+		if c.QuoteOf.Valid {
+			chirp.QuoteOf = &c.QuoteOf.UUID
+		}
+		chirps = append(chirps, chirp)
+	}
+
+	likeRows, err := cfg.db.ListUserLikesForExport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	likes := make([]exportLike, 0, len(likeRows))
+	for _, row := range likeRows {
+		likes = append(likes, exportLike{ChirpID: row.ChirpID, LikedAt: row.CreatedAt})
+	}
+
+	relationships, err := cfg.exportRelationships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := cfg.exportSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now().UTC()
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"chirps.json", chirps},
+		{"likes.json", likes},
+		{"relationships.json", relationships},
+		{"sessions.json", sessions},
+	}
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (cfg *apiConfig) exportRelationships(ctx context.Context, userID uuid.UUID) (exportRelationships, error) {
+	relationships := exportRelationships{
+		Following: []FollowListUser{},
+		Followers: []FollowListUser{},
+		Blocked:   []RelatedUser{},
+		Muted:     []RelatedUser{},
+	}
+
+	following, err := cfg.db.ListFollowingForExport(ctx, userID)
+	if err != nil {
+		return relationships, err
+	}
+	for _, row := range following {
+		relationships.Following = append(relationships.Following, FollowListUser(row))
+	}
+
+	followers, err := cfg.db.ListFollowersForExport(ctx, userID)
+	if err != nil {
+		return relationships, err
+	}
+	for _, row := range followers {
+		relationships.Followers = append(relationships.Followers, FollowListUser(row))
+	}
+
+	blocked, err := cfg.db.ListBlockedUsers(ctx, userID)
+	if err != nil {
+		return relationships, err
+	}
+	for _, row := range blocked {
+		relationships.Blocked = append(relationships.Blocked, RelatedUser{ID: row.ID, Handle: row.Handle, CreatedAt: row.BlockedAt})
+	}
+
+	muted, err := cfg.db.ListMutedUsers(ctx, userID)
+	if err != nil {
+		return relationships, err
+	}
+	for _, row := range muted {
+		relationships.Muted = append(relationships.Muted, RelatedUser{ID: row.ID, Handle: row.Handle, CreatedAt: row.MutedAt})
+	}
+
+	return relationships, nil
+}
+
+func (cfg *apiConfig) exportSessions(ctx context.Context, userID uuid.UUID) (exportSessions, error) {
+	sessions := exportSessions{
+		Sessions:             []Session{},
+		PersonalAccessTokens: []PersonalAccessToken{},
+		AuthorizedApps:       []OAuthConsent{},
+	}
+
+	rows, err := cfg.db.ListUserSessions(ctx, userID)
+	if err != nil {
+		return sessions, err
+	}
+	for _, row := range rows {
+		sessions.Sessions = append(sessions.Sessions, Session{
+			ID:         row.FamilyID,
+			StartedAt:  row.StartedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			UserAgent:  row.UserAgent,
+			IPAddress:  row.IpAddress,
+		})
+	}
+
+	tokens, err := cfg.db.ListPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return sessions, err
+	}
+	for _, token := range tokens {
+		sessions.PersonalAccessTokens = append(sessions.PersonalAccessTokens, databasePersonalAccessToken(token))
+	}
+
+	consents, err := cfg.db.ListOAuthConsents(ctx, userID)
+	if err != nil {
+		return sessions, err
+	}
+	for _, consent := range consents {
+		sessions.AuthorizedApps = append(sessions.AuthorizedApps, OAuthConsent(consent))
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDataExportLeavesOutSecrets(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	now := time.Now().UTC()
+	const tokenHash = "personal-access-token-hash"
+	db.setRows("ListPersonalAccessTokens", []driver.Value{
+		uuid.NewString(), user.ID.String(), "bot", "chirpy_pat_abcd", tokenHash,
+		[]byte("{chirps:read}"), now, nil, nil, nil,
+	})
+	db.setRows("ListUserSessions", []driver.Value{
+		uuid.NewString(), "curl/8.0", "192.0.2.1", now, now.Add(time.Hour), now,
+	})
+
+	archive, err := cfg.buildDataExport(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("buildDataExport error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("zip.NewReader error: %v", err)
+	}
+
+	var all strings.Builder
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", f.Name, err)
+		}
+		all.Write(data)
+	}
+	for _, want := range []string{user.Email, "chirpy_pat_abcd", "curl/8.0"} {
+		if !strings.Contains(all.String(), want) {
+			t.Errorf("export is missing %q", want)
+		}
+	}
+	for _, secret := range []string{user.HashedPassword, tokenHash, "hashed_password", "token_hash"} {
+		if strings.Contains(all.String(), secret) {
+			t.Errorf("export contains %q", secret)
+		}
+	}
+}
+
+func exportData(t *testing.T, cfg *apiConfig, user database.User) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/users/me/export", nil)
+	req.Header.Set("Authorization", "Bearer "+sessionToken(t, cfg, user))
+	w := httptest.NewRecorder()
+	cfg.handlerExportData(w, req)
+	return w
+}
+
+func TestDataExportConcurrencyLimit(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	db.setRows("CountUserChirps", []driver.Value{int64(exportSyncMaxChirps + 1)})
+	for i := 0; i < maxConcurrentDataExports; i++ {
+		cfg.dataExportSlots <- struct{}{}
+	}
+
+	w := exportData(t, cfg, user)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusServiceUnavailable, w.Body)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	if db.ran("CreateDataExport") {
+		t.Error("an export was started with no slot free")
+	}
+}
+
+func TestDataExportSyncTakesSlot(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	db.setRows("CountUserChirps", []driver.Value{int64(1)})
+	for i := 0; i < maxConcurrentDataExports; i++ {
+		cfg.dataExportSlots <- struct{}{}
+	}
+
+	w := exportData(t, cfg, user)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusServiceUnavailable, w.Body)
+	}
+	if db.ran("ListUserChirpsForExport") {
+		t.Error("an export was built with no slot free")
+	}
+
+	<-cfg.dataExportSlots
+	if w := exportData(t, cfg, user); w.Code != http.StatusOK {
+		t.Fatalf("status with a slot free = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if len(cfg.dataExportSlots) != maxConcurrentDataExports-1 {
+		t.Error("the export's slot wasn't freed")
+	}
+}
+
+func TestDataExportLocksUser(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	db.setRows("CountUserChirps", []driver.Value{int64(exportSyncMaxChirps + 1)})
+	now := time.Now().UTC()
+	db.setRows("CreateDataExport", []driver.Value{
+		uuid.NewString(), user.ID.String(), exportPending, now, nil, now.Add(dataExportDuration),
+	})
+	locked := false
+	db.handle("GetLatestDataExport", func([]driver.Value) [][]driver.Value {
+		locked = db.ran("LockUserDataExports")
+		return nil
+	})
+
+	w := exportData(t, cfg, user)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	if !locked {
+		t.Error("the latest export was looked up without locking the user")
+	}
+	if args := db.argsOf("LockUserDataExports"); len(args) != 1 || args[0][0] != user.ID.String() {
+		t.Errorf("LockUserDataExports calls = %v, want one for %s", args, user.ID)
+	}
+	if !db.ran("COMMIT") {
+		t.Error("the new export wasn't committed")
+	}
+
+	// Let the background export finish before the database closes.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cfg.dataExportSlots) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/SethGK/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	verificationTokenDuration = 24 * time.Hour
+	// verificationResendInterval is the minimum gap between two
+	// verification emails to the same account.
+	verificationResendInterval = time.Minute
+	// maxVerificationEmailsPerDay caps verification emails per account in
+	// any 24 hour window.
+	maxVerificationEmailsPerDay = 5
+)
+
+// Actions that can be withheld from users who have not verified their email,
+// as named in UNVERIFIED_USER_RESTRICTIONS.
+const (
+	restrictChirp   = "chirp"
+	restrictRechirp = "rechirp"
+	restrictLike    = "like"
+	restrictFollow  = "follow"
+)
+
+// parseRestrictions parses a comma separated list of restricted actions.
+func parseRestrictions(value string) (map[string]bool, error) {
+	restrictions := map[string]bool{}
+	for _, action := range strings.Split(value, ",") {
+		action = strings.TrimSpace(action)
+		switch action {
+		case "":
+		case restrictChirp, restrictRechirp, restrictLike, restrictFollow:
+			restrictions[action] = true
+		default:
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+	}
+	return restrictions, nil
+}
+
+// validateEmail rejects anything that is not a bare address such as
+// "user@example.com".
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("invalid email address")
+	}
+	return nil
+}
+
+// sendVerificationEmail stores a new verification token for email and mails
+// it to the user.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(verificationTokenDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\n"+
+			"To verify your email address, send this token to POST /api/users/verify:\n\n"+
+			"    %s\n\n"+
+			"The token expires in %s. If you did not sign up for Chirpy, you can ignore this email.\n",
+			token, verificationTokenDuration),
+	})
+}
+
+// requireVerifiedEmail reports whether userID may perform action. When the
+// action is restricted and the user's email is unverified it writes a 403
+// and returns false.
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uuid.UUID, action string) bool {
+	if !cfg.unverifiedRestrictions[action] {
+		return true
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", nil)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address to "+action, nil)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	token, err := qtx.GetEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	// The token only verifies the address it was sent to, not one the
+	// user has changed to since.
+	_, err = qtx.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    token.UserID,
+		Email: token.Email,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	if err := qtx.DeleteEmailVerificationTokens(r.Context(), token.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email address is already verified", nil)
+		return
+	}
+
+	now := time.Now().UTC()
+	stats, err := cfg.db.GetEmailVerificationStats(r.Context(), database.GetEmailVerificationStatsParams{
+		UserID:    userID,
+		CreatedAt: now.Add(-24 * time.Hour),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	var retryAt time.Time
+	switch {
+	case stats.Sent >= maxVerificationEmailsPerDay:
+		retryAt = stats.FirstSentAt.Add(24 * time.Hour)
+	case stats.Sent > 0 && now.Before(stats.LastSentAt.Add(verificationResendInterval)):
+		retryAt = stats.LastSentAt.Add(verificationResendInterval)
+	}
+	if !retryAt.IsZero() {
+		respondTooManyRequests(w, retryAt.Sub(now), "Too many verification emails, try again later")
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
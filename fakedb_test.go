@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeDB is a database/sql driver that answers the queries sqlc generated,
+// told apart by their "-- name:" comment, with canned rows or a handler
+// standing in for a table. Queries without either return no rows and
+// statements succeed, affecting one row. It records every query run with
+// its arguments, so tests can check what a handler did.
+type fakeDB struct {
+	mu       sync.Mutex
+	rows     map[string][][]driver.Value
+	handlers map[string]fakeHandler
+	queries  []fakeQuery
+}
+
+// fakeHandler answers a query from its arguments.
+type fakeHandler func(args []driver.Value) [][]driver.Value
+
+type fakeQuery struct {
+	name string
+	args []driver.Value
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		rows:     make(map[string][][]driver.Value),
+		handlers: make(map[string]fakeHandler),
+	}
+}
+
+// open returns a *sql.DB backed by db.
+func (db *fakeDB) open() *sql.DB {
+	return sql.OpenDB(db)
+}
+
+// setRows makes the query called name return rows.
+func (db *fakeDB) setRows(name string, rows ...[]driver.Value) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rows[name] = rows
+}
+
+// handle makes handler answer the query called name.
+func (db *fakeDB) handle(name string, handler fakeHandler) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.handlers[name] = handler
+}
+
+// ran reports whether the query called name has been run.
+func (db *fakeDB) ran(name string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, query := range db.queries {
+		if query.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// argsOf returns the arguments of each run of the query called name.
+func (db *fakeDB) argsOf(name string) [][]driver.Value {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var calls [][]driver.Value
+	for _, query := range db.queries {
+		if query.name == name {
+			calls = append(calls, query.args)
+		}
+	}
+	return calls
+}
+
+// run records query and returns its rows.
+func (db *fakeDB) run(query string, args []driver.NamedValue) [][]driver.Value {
+	name, values := db.record(query, args)
+	db.mu.Lock()
+	handler, rows := db.handlers[name], db.rows[name]
+	db.mu.Unlock()
+	if handler != nil {
+		return handler(values)
+	}
+	return rows
+}
+
+func (db *fakeDB) record(query string, args []driver.NamedValue) (string, []driver.Value) {
+	name := query
+	if rest, ok := strings.CutPrefix(query, "-- name: "); ok {
+		name, _, _ = strings.Cut(rest, " ")
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	db.queries = append(db.queries, fakeQuery{name: name, args: values})
+	return name, values
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return fakeDriver{db} }
+
+type fakeDriver struct{ db *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn(d), nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakeDB doesn't prepare statements: %s", query)
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return fakeTx(c), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{rows: c.db.run(query, args)}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.run(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx fakeTx) Commit() error {
+	tx.db.record("COMMIT", nil)
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.db.record("ROLLBACK", nil)
+	return nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i)
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
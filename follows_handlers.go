@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// UserProfile is the public view of a user, including follow counts.
+type UserProfile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+// FollowListUser is an entry in a followers or following list.
+type FollowListUser struct {
+	ID         uuid.UUID `json:"id"`
+	Handle     string    `json:"handle"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func followListUserCursor(u FollowListUser) pageCursor {
+	return pageCursor{CreatedAt: u.FollowedAt, ID: u.ID}
+}
+
+func (cfg *apiConfig) handlerGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !cfg.requireShownUser(w, r, user.ID) {
+		return
+	}
+
+	counts, err := cfg.db.GetFollowCounts(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error counting follows: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, UserProfile{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		Handle:         user.Handle,
+		IsChirpyRed:    user.IsChirpyRed,
+		FollowerCount:  counts.Followers,
+		FollowingCount: counts.Following,
+	}, http.StatusOK)
+}
+
+// requireShownUser reports whether userID is shown to others. Users the
+// hidden_chirp_authors view hides, such as banned ones and those deleting
+// their account, get a 404 as though they didn't exist.
+func (cfg *apiConfig) requireShownUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	hidden, err := cfg.hiddenAuthorIDs(r.Context(), []uuid.UUID{userID})
+	if err != nil {
+		log.Printf("Error checking hidden users: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if hidden[userID] {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(w, r, userID, restrictFollow) {
+		return
+	}
+
+	if followeeID == userID {
+		http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), followeeID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !cfg.requireShownUser(w, r, followeeID) {
+		return
+	}
+
+	blocked, err := cfg.db.HasBlockBetween(r.Context(), database.HasBlockBetweenParams{
+		UserID:  userID,
+		OtherID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error checking blocks: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You cannot follow this user", http.StatusForbidden)
+		return
+	}
+
+	err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error following user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error unfollowing user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, true)
+}
+
+func (cfg *apiConfig) handlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, false)
+}
+
+// listFollows serves a page of the users following (followers) or followed
+// by the user in the path, newest relationship first.
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, followers bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query(), sortDesc, sortAsc)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !cfg.requireShownUser(w, r, userID) {
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var users []FollowListUser
+	switch {
+	case followers && page.descending():
+		rows, qErr := cfg.db.ListFollowersDesc(r.Context(), database.ListFollowersDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+		for _, row := range rows {
+			users = append(users, FollowListUser{ID: row.ID, Handle: row.Handle, FollowedAt: row.FollowedAt})
+		}
+		err = qErr
+	case followers:
+		rows, qErr := cfg.db.ListFollowersAsc(r.Context(), database.ListFollowersAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+		for _, row := range rows {
+			users = append(users, FollowListUser{ID: row.ID, Handle: row.Handle, FollowedAt: row.FollowedAt})
+		}
+		err = qErr
+	case page.descending():
+		rows, qErr := cfg.db.ListFollowingDesc(r.Context(), database.ListFollowingDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+		for _, row := range rows {
+			users = append(users, FollowListUser{ID: row.ID, Handle: row.Handle, FollowedAt: row.FollowedAt})
+		}
+		err = qErr
+	default:
+		rows, qErr := cfg.db.ListFollowingAsc(r.Context(), database.ListFollowingAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+		for _, row := range rows {
+			users = append(users, FollowListUser{ID: row.ID, Handle: row.Handle, FollowedAt: row.FollowedAt})
+		}
+		err = qErr
+	}
+	if err != nil {
+		log.Printf("Error listing follows: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	users, next, prev := paginate(page, users, followListUserCursor)
+	if users == nil {
+		users = []FollowListUser{}
+	}
+
+	setPaginationLinks(w, r, next, prev)
+	sendJSONResponse(w, users, http.StatusOK)
+}
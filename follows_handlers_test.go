@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHiddenUserProfileNotFound(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	db.setRows("ListHiddenChirpAuthors", []driver.Value{user.ID.String()})
+
+	handlers := map[string]http.HandlerFunc{
+		"profile":   cfg.handlerGetUserProfile,
+		"followers": cfg.handlerGetFollowers,
+		"following": cfg.handlerGetFollowing,
+	}
+	for name, handler := range handlers {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/"+user.ID.String(), nil)
+		req.SetPathValue("userID", user.ID.String())
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d: %s", name, w.Code, http.StatusNotFound, w.Body)
+		}
+	}
+	for _, query := range []string{"GetFollowCounts", "ListFollowersDesc", "ListFollowingDesc"} {
+		if db.ran(query) {
+			t.Errorf("%s ran for a hidden user", query)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/SethGK/chirpy/internal/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+	maxTrendingLimit      = 50
+)
+
+// HashtagEntity locates a #tag inside a chirp body. Start and End are
+// offsets in Unicode code points, End being exclusive, and cover the '#'.
+type HashtagEntity struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type TrendingHashtag struct {
+	Tag     string `json:"tag"`
+	Uses    int64  `json:"uses"`
+	Authors int64  `json:"authors"`
+}
+
+func isHashtagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// extractHashtags finds every #tag in body. A tag must follow the start of
+// the body or a non-word character and contain at least one letter, so
+// "issue#12" and "#2024" are not tags. Tags are normalized to lower case.
+func extractHashtags(body string) []HashtagEntity {
+	var entities []HashtagEntity
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isHashtagRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		hasLetter := false
+		for end < len(runes) && isHashtagRune(runes[end]) {
+			hasLetter = hasLetter || unicode.IsLetter(runes[end])
+			end++
+		}
+		if !hasLetter {
+			continue
+		}
+
+		entities = append(entities, HashtagEntity{
+			Tag:   strings.ToLower(string(runes[i+1 : end])),
+			Start: i,
+			End:   end,
+		})
+		i = end - 1
+	}
+	return entities
+}
+
+// indexChirpHashtags replaces the stored hashtags of chirp with the ones in
+// its current body. Run it in the same transaction that writes the chirp.
+func indexChirpHashtags(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	if err := q.DeleteChirpHashtags(ctx, chirp.ID); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, entity := range extractHashtags(chirp.Body) {
+		if seen[entity.Tag] {
+			continue
+		}
+		seen[entity.Tag] = true
+
+		hashtag, err := q.UpsertHashtag(ctx, entity.Tag)
+		if err != nil {
+			return err
+		}
+		err = q.AddChirpHashtag(ctx, database.AddChirpHashtagParams{
+			ChirpID:   chirp.ID,
+			HashtagID: hashtag.ID,
+			CreatedAt: chirp.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerGetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		http.Error(w, "Invalid hashtag", http.StatusBadRequest)
+		return
+	}
+
+	viewer, err := cfg.optionalViewer(r)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query(), sortDesc, sortAsc)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var dbChirps []database.Chirp
+	if page.descending() {
+		dbChirps, err = cfg.db.ListChirpsByHashtagDesc(r.Context(), database.ListChirpsByHashtagDescParams{
+			Tag:             tag,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+	} else {
+		dbChirps, err = cfg.db.ListChirpsByHashtagAsc(r.Context(), database.ListChirpsByHashtagAscParams{
+			Tag:             tag,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			ViewerID:        viewer,
+			Limit:           page.fetchLimit(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error retrieving chirps for #%s: %s", tag, err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirps"}, http.StatusInternalServerError)
+		return
+	}
+
+	dbChirps, next, prev := paginate(page, dbChirps, databaseChirpCursor)
+
+	chirps, err := cfg.loadChirps(r.Context(), viewer, dbChirps)
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirps"}, http.StatusInternalServerError)
+		return
+	}
+
+	setPaginationLinks(w, r, next, prev)
+	sendJSONResponse(w, chirps, http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerGetTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingWindow
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := time.ParseDuration(windowStr)
+		if err != nil || parsed <= 0 || parsed > maxTrendingWindow {
+			sendJSONResponse(w, ErrorResponse{Error: "window must be a positive duration of at most 168h"}, http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	limit := defaultTrendingLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			sendJSONResponse(w, ErrorResponse{Error: "limit must be a positive integer"}, http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxTrendingLimit)
+	}
+
+	rows, err := cfg.db.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		Since: time.Now().Add(-window),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error retrieving trending hashtags: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve trending hashtags"}, http.StatusInternalServerError)
+		return
+	}
+
+	trending := make([]TrendingHashtag, 0, len(rows))
+	for _, row := range rows {
+		trending = append(trending, TrendingHashtag{
+			Tag:     row.Tag,
+			Uses:    row.Uses,
+			Authors: row.Authors,
+		})
+	}
+
+	sendJSONResponse(w, trending, http.StatusOK)
+}
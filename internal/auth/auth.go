@@ -1,17 +1,204 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+var (
+	// ErrPasswordMismatch is returned when a password doesn't match its hash.
+	ErrPasswordMismatch = errors.New("password does not match")
+	// ErrUnknownHashFormat is returned for hashes no configured hasher reads.
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+// Hasher is one password hashing scheme.
+type Hasher interface {
+	// Hash encodes password with a fresh salt.
+	Hash(password string) (string, error)
+	// Recognizes reports whether encoded was produced by this scheme.
+	Recognizes(encoded string) bool
+	// Verify checks password against encoded, returning ErrPasswordMismatch
+	// when it doesn't match.
+	Verify(password, encoded string) error
+	// NeedsRehash reports whether encoded was made with parameters other
+	// than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Passwords hashes new passwords with its current hasher and verifies
+// hashes from any of its hashers, so stored hashes can be migrated to the
+// current scheme as users sign in.
+type Passwords struct {
+	current Hasher
+	legacy  []Hasher
+}
+
+func NewPasswords(current Hasher, legacy ...Hasher) *Passwords {
+	return &Passwords{current: current, legacy: legacy}
+}
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.current.Hash(password)
+}
+
+// Verify checks password against encoded. When it matches, rehash reports
+// whether encoded should be replaced with a fresh Hash of the password.
+func (p *Passwords) Verify(password, encoded string) (rehash bool, err error) {
+	for _, h := range append([]Hasher{p.current}, p.legacy...) {
+		if !h.Recognizes(encoded) {
+			continue
+		}
+		if err := h.Verify(password, encoded); err != nil {
+			return false, err
+		}
+		return h != p.current || h.NeedsRehash(encoded), nil
+	}
+	return false, ErrUnknownHashFormat
+}
+
+// Argon2idParams tune argon2id. Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams are the second recommended option of RFC 9106,
+// for when 2 GiB per hash is out of reach.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes with argon2id, encoded in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) (*Argon2idHasher, error) {
+	if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, errors.New("argon2id needs at least one iteration and thread, and 8 KiB of memory per thread")
+	}
+	if params.SaltLength < 8 || params.KeyLength < 16 {
+		return nil, errors.New("argon2id needs a salt of at least 8 bytes and a key of at least 16")
+	}
+	return &Argon2idHasher{Params: params}, nil
+}
+
+const argon2idPrefix = "$argon2id$"
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version,
+		h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	return err != nil || params != h.Params
+}
+
+// decodeArgon2id parses a PHC string. The returned params carry the salt
+// and key lengths actually found.
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// DefaultBcryptCost is the cost passwords were hashed with before argon2id.
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+// BcryptHasher hashes with bcrypt, which stored passwords used before
+// argon2id.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hashedBytes), nil
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	_, err := bcrypt.Cost([]byte(encoded))
+	return err == nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
 }
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams keep the tests fast; they are far too cheap for real
+// passwords.
+var testArgon2idParams = Argon2idParams{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func newTestPasswords(t *testing.T, params Argon2idParams) *Passwords {
+	t.Helper()
+	argon, err := NewArgon2idHasher(params)
+	if err != nil {
+		t.Fatalf("NewArgon2idHasher error: %v", err)
+	}
+	return NewPasswords(argon, &BcryptHasher{Cost: bcrypt.MinCost})
+}
+
+func TestArgon2idHash(t *testing.T) {
+	passwords := newTestPasswords(t, testArgon2idParams)
+
+	hash, err := passwords.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected PHC string %q", hash)
+	}
+
+	other, err := passwords.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	if hash == other {
+		t.Fatal("expected a fresh salt for every hash")
+	}
+
+	rehash, err := passwords.Verify("hunter2", hash)
+	if err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+	if rehash {
+		t.Error("expected a current hash not to need rehashing")
+	}
+
+	if _, err := passwords.Verify("hunter3", hash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+}
+
+func TestArgon2idParamsChange(t *testing.T) {
+	old := newTestPasswords(t, testArgon2idParams)
+	hash, err := old.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+
+	stronger := testArgon2idParams
+	stronger.Iterations = 2
+	current := newTestPasswords(t, stronger)
+
+	rehash, err := current.Verify("hunter2", hash)
+	if err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+	if !rehash {
+		t.Error("expected a hash with old parameters to need rehashing")
+	}
+}
+
+func TestLegacyBcryptHash(t *testing.T) {
+	passwords := newTestPasswords(t, testArgon2idParams)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt error: %v", err)
+	}
+
+	rehash, err := passwords.Verify("hunter2", string(legacy))
+	if err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+	if !rehash {
+		t.Error("expected a bcrypt hash to need rehashing to argon2id")
+	}
+
+	if _, err := passwords.Verify("hunter3", string(legacy)); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+}
+
+func TestUnknownHashFormat(t *testing.T) {
+	passwords := newTestPasswords(t, testArgon2idParams)
+	if _, err := passwords.Verify("hunter2", "plaintext"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Fatalf("expected ErrUnknownHashFormat, got %v", err)
+	}
+}
+
+func TestNewArgon2idHasherRejectsWeakParams(t *testing.T) {
+	weak := testArgon2idParams
+	weak.Iterations = 0
+	if _, err := NewArgon2idHasher(weak); err == nil {
+		t.Fatal("expected zero iterations to be rejected")
+	}
+}
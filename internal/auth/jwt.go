@@ -2,6 +2,7 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -10,46 +11,161 @@ import (
 	"github.com/google/uuid"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// Issuer is the iss claim of every access token.
+const Issuer = "chirpy"
+
+// Errors returned by ParseJWT and ValidateJWT, wrapped with details.
+var (
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token has expired")
+	ErrTokenInvalidClaims    = errors.New("token claims are invalid")
+)
+
+// ErrNoAuthHeaderIncluded is returned when a request has no Authorization
+// header at all.
+var ErrNoAuthHeaderIncluded = errors.New("authorization header missing")
+
+// ErrTokenUnknown is returned for opaque tokens that were never issued or
+// have been revoked.
+var ErrTokenUnknown = errors.New("token is unknown or revoked")
+
+// PurposeMFA marks tokens that only prove a password was checked and can be
+// exchanged for an access token together with a second factor.
+const PurposeMFA = "mfa"
+
+// Claims are the claims carried by access tokens. SessionID names the
+// refresh token family the token was issued from, when there is one.
+// Purpose is empty for access tokens and set for special-purpose tokens,
+// which are never accepted in their place. Scope, when set, limits the
+// token to the space separated scopes it lists; see HasScope. ClientID
+// names the OAuth client a delegated token was issued to. Role is the
+// user's role when a session token was issued; see HasRole.
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+func MakeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, uuid.Nil, Claims{}, keys, expiresIn)
+}
+
+// MakeSessionJWT is like MakeJWT but ties the token to a session, which
+// lets handlers tell the caller's own session apart from their others, and
+// records the user's role.
+func MakeSessionJWT(userID, sessionID uuid.UUID, role string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, sessionID, Claims{Role: role}, keys, expiresIn)
+}
+
+// MakeDelegatedJWT issues an access token to an OAuth client, limited to
+// scopes. Its session is the refresh token family of the client's grant.
+func MakeDelegatedJWT(userID, sessionID uuid.UUID, clientID string, scopes []string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, sessionID, Claims{
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
+	}, keys, expiresIn)
+}
+
+// MakeMFAChallengeJWT issues the token returned by a password login when the
+// account has a second factor. It is only accepted by ParseMFAChallengeJWT.
+func MakeMFAChallengeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, uuid.Nil, Claims{Purpose: PurposeMFA}, keys, expiresIn)
+}
+
+// makeJWT signs claims, which carry only the private claims to set, after
+// filling in the registered ones.
+func makeJWT(userID, sessionID uuid.UUID, claims Claims, keys *Keyring, expiresIn time.Duration) (string, error) {
 	now := time.Now().UTC()
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    Issuer,
 		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
 		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
 		Subject:   userID.String(),
 	}
+	if audience := keys.audience(); audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return keys.sign(claims)
+}
 
-	return token.SignedString([]byte(tokenSecret))
+func ValidateJWT(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+// ParseJWT validates an access token against the keyring and returns its
+// claims. Only the asymmetric algorithms the keyring signs with are
+// accepted, and the time, issuer and audience claims are checked with the
+// keyring's leeway. Errors wrap one of the ErrToken values.
+func ParseJWT(tokenString string, keys *Keyring) (*Claims, error) {
+	return parseJWT(tokenString, "", keys)
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// ParseMFAChallengeJWT is like ParseJWT for tokens from MakeMFAChallengeJWT.
+func ParseMFAChallengeJWT(tokenString string, keys *Keyring) (*Claims, error) {
+	return parseJWT(tokenString, PurposeMFA, keys)
+}
+
+func parseJWT(tokenString, purpose string, keys *Keyring) (*Claims, error) {
+	claims := Claims{}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithoutClaimsValidation(),
+	)
+	token, err := parser.ParseWithClaims(tokenString, &claims, keys.keyfunc)
 	if err != nil {
-		return uuid.Nil, err
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&(jwt.ValidationErrorUnverifiable|jwt.ValidationErrorSignatureInvalid) != 0 {
+			return nil, fmt.Errorf("%w: %v", ErrTokenSignatureInvalid, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
 	}
 	if !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
+		return nil, ErrTokenSignatureInvalid
 	}
 
-	id, err := uuid.Parse((claims.Subject))
-	if err != nil {
-		return uuid.Nil, err
+	if err := keys.validateClaims(&claims); err != nil {
+		return nil, err
 	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("%w: unexpected token purpose %q", ErrTokenInvalidClaims, claims.Purpose)
+	}
+	return &claims, nil
+}
 
-	return id, nil
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// Session returns the session the token belongs to, or a null ID for
+// tokens issued outside of one.
+func (c *Claims) Session() uuid.NullUUID {
+	id, err := uuid.Parse(c.SessionID)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: id, Valid: true}
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("authorization header missing")
+		return "", ErrNoAuthHeaderIncluded
 	}
 	const prefix = "Bearer "
 	if !strings.HasPrefix(authHeader, prefix) {
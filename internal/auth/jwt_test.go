@@ -1,58 +1,245 @@
 package auth
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 )
 
+func newTestKeyring(t *testing.T, algorithm string) *Keyring {
+	t.Helper()
+	key, err := GenerateSigningKey(algorithm, time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	return NewKeyring(key)
+}
+
 func TestMakeAndValidateJWT(t *testing.T) {
-	secret := "mysecret"
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			keys := newTestKeyring(t, alg)
+			userID := uuid.New()
+
+			token, err := MakeJWT(userID, keys, time.Minute)
+			if err != nil {
+				t.Fatalf("MakeJWT error: %v", err)
+			}
+
+			validateUserID, err := ValidateJWT(token, keys)
+			if err != nil {
+				t.Fatalf("ValidateJWT error: %v", err)
+			}
+
+			if validateUserID != userID {
+				t.Fatalf("expected userID %s, got %s", userID, validateUserID)
+			}
+		})
+	}
+}
+
+func TestExpiredJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
 	userID := uuid.New()
 
-	token, err := MakeJWT(userID, secret, time.Minute)
+	token, err := MakeJWT(userID, keys, -time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT error: %v", err)
 	}
 
-	validateUserID, err := ValidateJWT(token, secret)
+	_, err = ValidateJWT(token, keys)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestExpiredJWTWithinLeeway(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	if err := keys.Configure("", time.Minute); err != nil {
+		t.Fatalf("Configure error: %v", err)
+	}
+
+	token, err := MakeJWT(uuid.New(), keys, -30*time.Second)
+	if err != nil {
+		t.Fatalf("MakeJWT error: %v", err)
+	}
+
+	if _, err := ValidateJWT(token, keys); err != nil {
+		t.Fatalf("expected token within leeway to validate, got %v", err)
+	}
+}
+
+func TestConfigureRejectsUnboundedLeeway(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	if err := keys.Configure("", MaxLeeway+time.Second); err == nil {
+		t.Fatalf("expected leeway above MaxLeeway to be rejected")
+	}
+}
+
+func TestMalformedJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+
+	_, err := ValidateJWT("not-a-jwt", keys)
+	if !errors.Is(err, ErrTokenMalformed) {
+		t.Fatalf("expected ErrTokenMalformed, got %v", err)
+	}
+}
+
+func TestUnexpectedAlgorithmJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	key, _ := keys.Newest()
+
+	// An HS256 token naming a real kid must not be verified with
+	// anything derived from the public key.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    Issuer,
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("SignedString error: %v", err)
+	}
+
+	_, err = ValidateJWT(signed, keys)
+	if !errors.Is(err, ErrTokenSignatureInvalid) {
+		t.Fatalf("expected ErrTokenSignatureInvalid, got %v", err)
+	}
+}
+
+func TestWrongIssuerJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+
+	signed, err := keys.sign(Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    "someone-else",
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	if err != nil {
+		t.Fatalf("sign error: %v", err)
+	}
+
+	_, err = ValidateJWT(signed, keys)
+	if !errors.Is(err, ErrTokenInvalidClaims) {
+		t.Fatalf("expected ErrTokenInvalidClaims, got %v", err)
+	}
+}
+
+func TestAudienceJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	if err := keys.Configure("chirpy-api", DefaultLeeway); err != nil {
+		t.Fatalf("Configure error: %v", err)
+	}
+
+	token, err := MakeJWT(uuid.New(), keys, time.Minute)
 	if err != nil {
+		t.Fatalf("MakeJWT error: %v", err)
+	}
+	if _, err := ValidateJWT(token, keys); err != nil {
 		t.Fatalf("ValidateJWT error: %v", err)
 	}
 
-	if validateUserID != userID {
-		t.Fatalf("expected userID %s, got %s", userID, validateUserID)
+	if err := keys.Configure("another-api", DefaultLeeway); err != nil {
+		t.Fatalf("Configure error: %v", err)
+	}
+	_, err = ValidateJWT(token, keys)
+	if !errors.Is(err, ErrTokenInvalidClaims) {
+		t.Fatalf("expected ErrTokenInvalidClaims, got %v", err)
 	}
 }
 
-func TextExpiredJWT(t *testing.T) {
-	secret := "mysecret"
+func TestWrongKeyJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	otherKeys := newTestKeyring(t, AlgEdDSA)
 	userID := uuid.New()
 
-	token, err := MakeJWT(userID, secret, -time.Minute)
+	token, err := MakeJWT(userID, keys, time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT error: %v", err)
 	}
 
-	_, err = ValidateJWT(token, secret)
-	if err == nil {
-		t.Fatalf("expected token to be expired, but validation passed")
+	_, err = ValidateJWT(token, otherKeys)
+	if !errors.Is(err, ErrTokenSignatureInvalid) {
+		t.Fatalf("expected ErrTokenSignatureInvalid, got %v", err)
+	}
+}
+
+func TestSessionJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := MakeSessionJWT(userID, sessionID, RoleUser, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT error: %v", err)
+	}
+
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT error: %v", err)
+	}
+
+	if got := claims.Session(); !got.Valid || got.UUID != sessionID {
+		t.Fatalf("expected session %s, got %v", sessionID, got)
 	}
 }
 
-func TestWrongSecretJWT(t *testing.T) {
-	secret := "mysecret"
-	wrongSecret := "wrongsecret"
+func TestMFAChallengeJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
 	userID := uuid.New()
 
-	token, err := MakeJWT(userID, secret, time.Minute)
+	challenge, err := MakeMFAChallengeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAChallengeJWT error: %v", err)
+	}
+	claims, err := ParseMFAChallengeJWT(challenge, keys)
+	if err != nil {
+		t.Fatalf("ParseMFAChallengeJWT error: %v", err)
+	}
+	if got, _ := claims.UserID(); got != userID {
+		t.Fatalf("expected userID %s, got %s", userID, got)
+	}
+
+	if _, err := ParseJWT(challenge, keys); !errors.Is(err, ErrTokenInvalidClaims) {
+		t.Fatalf("expected challenge to be rejected as an access token, got %v", err)
+	}
+
+	access, err := MakeJWT(userID, keys, time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT error: %v", err)
 	}
+	if _, err := ParseMFAChallengeJWT(access, keys); !errors.Is(err, ErrTokenInvalidClaims) {
+		t.Fatalf("expected access token to be rejected as a challenge, got %v", err)
+	}
+}
 
-	_, err = ValidateJWT(token, wrongSecret)
-	if err == nil {
-		t.Fatalf("expected validation to fail with wrong secret, but it passed")
+func TestDelegatedJWT(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := MakeDelegatedJWT(userID, sessionID, "client-1", []string{ScopeChirpsRead, ScopeChirpsWrite}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeDelegatedJWT error: %v", err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT error: %v", err)
+	}
+	if claims.FullAccess() {
+		t.Fatal("expected a delegated token not to have full access")
+	}
+	if !claims.HasScope(ScopeChirpsWrite) || claims.HasScope(ScopeProfileWrite) {
+		t.Fatalf("unexpected scopes %q", claims.Scope)
+	}
+	if claims.ClientID != "client-1" {
+		t.Fatalf("expected client_id client-1, got %q", claims.ClientID)
+	}
+	if got := claims.Session(); !got.Valid || got.UUID != sessionID {
+		t.Fatalf("expected session %s, got %v", sessionID, got)
 	}
 }
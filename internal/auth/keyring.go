@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms, named as they appear in a token's alg header.
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const rsaKeyBits = 2048
+
+// SigningKey is a private key used to sign access tokens. Tokens carry the
+// key's ID in their kid header, and the key keeps verifying them until
+// ExpiresAt, well after newer keys have taken over signing. A key is
+// published and verifies from CreatedAt, but only signs from ActiveAt, so
+// verifiers can learn it before tokens signed with it turn up.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+	ActiveAt   time.Time
+	ExpiresAt  time.Time
+}
+
+// GenerateSigningKey creates a new key for algorithm, valid for lifetime
+// and signing from now.
+func GenerateSigningKey(algorithm string, now time.Time, lifetime time.Duration) (SigningKey, error) {
+	var privateKey crypto.Signer
+	switch algorithm {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		privateKey = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		privateKey = key
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return SigningKey{}, err
+	}
+
+	return SigningKey{
+		ID:         base64.RawURLEncoding.EncodeToString(id),
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		CreatedAt:  now,
+		ActiveAt:   now,
+		ExpiresAt:  now.Add(lifetime),
+	}, nil
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+const (
+	// DefaultLeeway is the clock skew tolerated by a new keyring.
+	DefaultLeeway = 30 * time.Second
+	// MaxLeeway bounds the clock skew a keyring can be configured with.
+	MaxLeeway = 5 * time.Minute
+)
+
+// Keyring holds the keys tokens are signed and verified with. The newest
+// active key signs; every unexpired key verifies. It also carries the audience
+// tokens are issued for and the clock skew tolerated when checking them.
+// It is safe for concurrent use.
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   []SigningKey
+	aud    string
+	leeway time.Duration
+	now    func() time.Time
+}
+
+func NewKeyring(keys ...SigningKey) *Keyring {
+	r := &Keyring{leeway: DefaultLeeway, now: time.Now}
+	r.Replace(keys)
+	return r
+}
+
+// Configure sets the audience tokens are issued for and must carry, and the
+// clock skew tolerated on their time claims. An empty audience disables
+// the audience check.
+func (r *Keyring) Configure(audience string, leeway time.Duration) error {
+	if leeway < 0 || leeway > MaxLeeway {
+		return fmt.Errorf("leeway must be between 0 and %s", MaxLeeway)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aud = audience
+	r.leeway = leeway
+	return nil
+}
+
+func (r *Keyring) audience() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.aud
+}
+
+// Replace swaps in a new set of keys, such as a fresh load from storage.
+func (r *Keyring) Replace(keys []SigningKey) {
+	sorted := append([]SigningKey(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = sorted
+}
+
+// Newest returns the key currently used for signing.
+func (r *Keyring) Newest() (SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+	for _, key := range r.keys {
+		if key.ExpiresAt.After(now) && !key.ActiveAt.After(now) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// Latest returns the most recently created unexpired key, which may not
+// be signing yet.
+func (r *Keyring) Latest() (SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+	for _, key := range r.keys {
+		if key.ExpiresAt.After(now) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// Lookup returns the unexpired key with the given ID.
+func (r *Keyring) Lookup(id string) (SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+	for _, key := range r.keys {
+		if key.ID == id && key.ExpiresAt.After(now) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+func (r *Keyring) sign(claims jwt.Claims) (string, error) {
+	key, ok := r.Newest()
+	if !ok {
+		return "", errors.New("no signing key available")
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// keyfunc resolves the public key for a token from its kid header. The
+// token's alg must match the algorithm the key was generated for.
+func (r *Keyring) keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := r.Lookup(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+func (r *Keyring) validateClaims(claims *Claims) error {
+	r.mu.RLock()
+	audience, leeway := r.aud, r.leeway
+	r.mu.RUnlock()
+	now := r.now()
+
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp", ErrTokenInvalidClaims)
+	}
+	if !now.Before(claims.ExpiresAt.Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(leeway).Before(claims.NotBefore.Time) {
+		return fmt.Errorf("%w: not valid yet", ErrTokenInvalidClaims)
+	}
+	if claims.IssuedAt != nil && now.Add(leeway).Before(claims.IssuedAt.Time) {
+		return fmt.Errorf("%w: issued in the future", ErrTokenInvalidClaims)
+	}
+	if claims.Issuer != Issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalidClaims, claims.Issuer)
+	}
+	if audience != "" && !claims.VerifyAudience(audience, true) {
+		return fmt.Errorf("%w: token is not for audience %q", ErrTokenInvalidClaims, audience)
+	}
+	if _, err := claims.UserID(); err != nil {
+		return fmt.Errorf("%w: invalid subject", ErrTokenInvalidClaims)
+	}
+	return nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every unexpired key.
+func (r *Keyring) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.now()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range r.keys {
+		if !key.ExpiresAt.After(now) {
+			continue
+		}
+		jwk := JWK{Use: "sig", Algorithm: key.Algorithm, KeyID: key.ID}
+		switch pub := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// SealPrivateKey encrypts a private key for storage with AES-GCM under a
+// key derived from secret.
+func SealPrivateKey(key crypto.Signer, secret string) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return Seal(der, secret)
+}
+
+// OpenPrivateKey reverses SealPrivateKey.
+func OpenPrivateKey(sealed []byte, secret string) (crypto.Signer, error) {
+	der, err := Open(sealed, secret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("stored key cannot sign")
+	}
+	return signer, nil
+}
+
+// Seal encrypts plaintext for storage with AES-GCM under a key derived from
+// secret.
+func Seal(plaintext []byte, secret string) ([]byte, error) {
+	aead, err := keyEncryption(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open reverses Seal.
+func Open(sealed []byte, secret string) ([]byte, error) {
+	aead, err := keyEncryption(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func keyEncryption(secret string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
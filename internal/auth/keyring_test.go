@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	now := time.Now()
+	oldKey, err := GenerateSigningKey(AlgRS256, now.Add(-time.Hour), 2*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	keys := NewKeyring(oldKey)
+	userID := uuid.New()
+
+	oldToken, err := MakeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT error: %v", err)
+	}
+
+	newKey, err := GenerateSigningKey(AlgEdDSA, now, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	keys.Replace([]SigningKey{oldKey, newKey})
+
+	if newest, _ := keys.Newest(); newest.ID != newKey.ID {
+		t.Fatalf("expected newest key %s, got %s", newKey.ID, newest.ID)
+	}
+	if _, err := ValidateJWT(oldToken, keys); err != nil {
+		t.Fatalf("token signed by the previous key should still validate: %v", err)
+	}
+
+	if got := len(keys.JWKS().Keys); got != 2 {
+		t.Fatalf("expected 2 published keys, got %d", got)
+	}
+}
+
+func TestKeyringPublishesKeysBeforeSigning(t *testing.T) {
+	now := time.Now()
+	current, err := GenerateSigningKey(AlgEdDSA, now.Add(-time.Hour), 2*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	next, err := GenerateSigningKey(AlgEdDSA, now, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	next.ActiveAt = now.Add(5 * time.Minute)
+	keys := NewKeyring(current, next)
+
+	if newest, _ := keys.Newest(); newest.ID != current.ID {
+		t.Fatalf("expected the current key %s to sign until the next one is active, got %s", current.ID, newest.ID)
+	}
+	if latest, _ := keys.Latest(); latest.ID != next.ID {
+		t.Fatalf("expected latest key %s, got %s", next.ID, latest.ID)
+	}
+	if got := len(keys.JWKS().Keys); got != 2 {
+		t.Fatalf("expected the pending key to be published too, got %d keys", got)
+	}
+
+	keys.now = func() time.Time { return now.Add(6 * time.Minute) }
+	if newest, _ := keys.Newest(); newest.ID != next.ID {
+		t.Fatalf("expected the next key %s to sign once active, got %s", next.ID, newest.ID)
+	}
+}
+
+func TestKeyringRejectsExpiredKey(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA, time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey error: %v", err)
+	}
+	keys := NewKeyring(key)
+
+	token, err := MakeJWT(uuid.New(), keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT error: %v", err)
+	}
+
+	keys.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Fatalf("expected validation to fail once the key expired")
+	}
+	if got := len(keys.JWKS().Keys); got != 0 {
+		t.Fatalf("expected expired key to be unpublished, got %d keys", got)
+	}
+}
+
+func TestSealPrivateKey(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg, time.Now(), time.Hour)
+			if err != nil {
+				t.Fatalf("GenerateSigningKey error: %v", err)
+			}
+
+			sealed, err := SealPrivateKey(key.PrivateKey, "secret")
+			if err != nil {
+				t.Fatalf("SealPrivateKey error: %v", err)
+			}
+
+			opened, err := OpenPrivateKey(sealed, "secret")
+			if err != nil {
+				t.Fatalf("OpenPrivateKey error: %v", err)
+			}
+			if !opened.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.PrivateKey.Public()) {
+				t.Fatalf("opened key does not match the sealed key")
+			}
+
+			if _, err := OpenPrivateKey(sealed, "wrong"); err == nil {
+				t.Fatalf("expected opening with the wrong secret to fail")
+			}
+		})
+	}
+}
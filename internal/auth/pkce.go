@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// PKCEMethodS256 is the only PKCE challenge method accepted; "plain" would
+// let anyone who sees the authorization request redeem the code.
+const PKCEMethodS256 = "S256"
+
+// pkceVerifierPattern is the code_verifier syntax from RFC 7636 section 4.1.
+var pkceVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// pkceChallengePattern matches a base64url SHA-256 digest without padding.
+var pkceChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+
+// PKCEChallenge returns the S256 code_challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidPKCEChallenge reports whether challenge could be an S256 challenge.
+func ValidPKCEChallenge(challenge string) bool {
+	return pkceChallengePattern.MatchString(challenge)
+}
+
+// VerifyPKCE reports whether verifier is well formed and hashes to
+// challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !pkceVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
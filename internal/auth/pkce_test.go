@@ -0,0 +1,34 @@
+package auth
+
+import "testing"
+
+// The example from RFC 7636 appendix B.
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	if got := PKCEChallenge(rfcVerifier); got != rfcChallenge {
+		t.Fatalf("expected challenge %s, got %s", rfcChallenge, got)
+	}
+	if !ValidPKCEChallenge(rfcChallenge) {
+		t.Fatal("expected the RFC challenge to be well formed")
+	}
+	if ValidPKCEChallenge("short") {
+		t.Fatal("expected a short challenge to be rejected")
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	if !VerifyPKCE(rfcVerifier, rfcChallenge) {
+		t.Fatal("expected the RFC verifier to match its challenge")
+	}
+	if VerifyPKCE(rfcVerifier[:42]+"x", rfcChallenge) {
+		t.Fatal("expected a different verifier to be rejected")
+	}
+	short := "abc"
+	if VerifyPKCE(short, PKCEChallenge(short)) {
+		t.Fatal("expected a verifier shorter than 43 characters to be rejected")
+	}
+}
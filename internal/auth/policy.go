@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// BcryptMaxBytes is the most of a password bcrypt reads; anything after it
+// is silently ignored, so no policy may allow longer passwords.
+const BcryptMaxBytes = 72
+
+// Password policy rules, as reported in PasswordViolation.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleNotEmail  = "not_email"
+	RuleBreached  = "not_breached"
+)
+
+// PasswordViolation is one rule a password broke.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password broke.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password rejected: " + strings.Join(messages, "; ")
+}
+
+// BreachedPasswords looks up known breached passwords k-anonymity style:
+// given the first five hex digits of a password's SHA-1, Range returns the
+// remaining 35 digits of every breached hash with that prefix.
+type BreachedPasswords interface {
+	Range(prefix string) ([]string, error)
+}
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	// MinLength is counted in characters.
+	MinLength int
+	// MaxBytes is counted in UTF-8 bytes, up to BcryptMaxBytes.
+	MaxBytes int
+	// Breached, when set, rejects passwords found in it.
+	Breached BreachedPasswords
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: at least 8 characters and
+// as long as the hash allows.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxBytes:  BcryptMaxBytes,
+}
+
+// Validate reports whether the policy's limits are usable.
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength < 1 {
+		return errors.New("minimum password length must be at least 1")
+	}
+	if p.MaxBytes > BcryptMaxBytes {
+		return fmt.Errorf("maximum password length can't exceed bcrypt's %d bytes", BcryptMaxBytes)
+	}
+	if p.MaxBytes < p.MinLength {
+		return errors.New("maximum password length is below the minimum")
+	}
+	return nil
+}
+
+// Check returns a *PasswordPolicyError listing every rule password breaks
+// for the account with the given email, or an error if the breach lookup
+// fails.
+func (p PasswordPolicy) Check(password, email string) error {
+	var violations []PasswordViolation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if len(password) > p.MaxBytes {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes long", p.MaxBytes),
+		})
+	}
+	if isEmailPassword(password, email) {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleNotEmail,
+			Message: "Password must not be your email address",
+		})
+	}
+	if p.Breached != nil {
+		breached, err := isBreached(p.Breached, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Rule:    RuleBreached,
+				Message: "Password has appeared in a data breach; choose another",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// isEmailPassword reports whether password is the email address or its
+// local part, ignoring case.
+func isEmailPassword(password, email string) bool {
+	password = strings.ToLower(strings.TrimSpace(password))
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return password == email || password == local
+}
+
+func isBreached(breached BreachedPasswords, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := breached.Range(digest[:5])
+	if err != nil {
+		return false, err
+	}
+	i := sort.SearchStrings(suffixes, digest[5:])
+	return i < len(suffixes) && suffixes[i] == digest[5:], nil
+}
+
+// BreachedHashFile looks up breached hashes in a file sorted by hash, such
+// as the Have I Been Pwned "ordered by hash" download, by binary search on
+// disk. Only the lines it compares are read, so the file can be far larger
+// than memory. Each line holds a SHA-1 hash in hex, optionally followed by
+// ":count" as in the Have I Been Pwned downloads. Lines starting with #
+// may only appear at the top.
+type BreachedHashFile struct {
+	f    *os.File
+	size int64
+}
+
+// OpenBreachedHashesFile opens the sorted hash file at path.
+func OpenBreachedHashesFile(path string) (*BreachedHashFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	b := &BreachedHashFile{f: f, size: info.Size()}
+
+	// Catch a file in the wrong format now rather than at the first signup.
+	for off := int64(0); off < b.size; {
+		line, next, err := b.readLine(off)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if text := strings.TrimSpace(line); text != "" && !strings.HasPrefix(text, "#") {
+			if !isSHA1Hex(breachedHashKey(line)) {
+				f.Close()
+				return nil, errors.New("first entry is not a SHA-1 hash")
+			}
+			break
+		}
+		off = next
+	}
+	return b, nil
+}
+
+func (b *BreachedHashFile) Close() error {
+	return b.f.Close()
+}
+
+// Range returns the sorted hash suffixes under prefix.
+func (b *BreachedHashFile) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+
+	// Find the first line whose hash isn't below prefix.
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := b.lineStartFrom(mid)
+		if err != nil {
+			return nil, err
+		}
+		below := false
+		if start < b.size {
+			line, _, err := b.readLine(start)
+			if err != nil {
+				return nil, err
+			}
+			below = breachedHashKey(line) < prefix
+		}
+		if below {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	start, err := b.lineStartFrom(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	scanner := bufio.NewScanner(io.NewSectionReader(b.f, start, b.size-start))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash := breachedHashKey(text)
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		if !isSHA1Hex(hash) {
+			return nil, fmt.Errorf("%q is not a SHA-1 hash", text)
+		}
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+	return suffixes, scanner.Err()
+}
+
+// lineStartFrom returns the offset of the first line starting at or after
+// off.
+func (b *BreachedHashFile) lineStartFrom(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	_, next, err := b.readLine(off - 1)
+	return next, err
+}
+
+// readLine returns the line containing off from there to its end, without
+// the line ending, and the offset of the next line.
+func (b *BreachedHashFile) readLine(off int64) (string, int64, error) {
+	var line []byte
+	buf := make([]byte, 128)
+	for pos := off; pos < b.size; {
+		n, err := b.f.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			line = append(line, buf[:i]...)
+			return strings.TrimRight(string(line), "\r"), pos + int64(i) + 1, nil
+		}
+		line = append(line, buf[:n]...)
+		pos += int64(n)
+		if err != nil && err != io.EOF {
+			return "", 0, err
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), b.size, nil
+}
+
+// breachedHashKey is the upper-case hash on a corpus line.
+func breachedHashKey(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(hash)
+}
+
+func isSHA1Hex(hash string) bool {
+	if len(hash) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func policyRules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a PasswordPolicyError, got %v", err)
+	}
+	rules := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	breached, err := OpenBreachedHashesFile(writeBreachedFile(t, []string{"password123"}))
+	if err != nil {
+		t.Fatalf("OpenBreachedHashesFile error: %v", err)
+	}
+	defer breached.Close()
+	policy := DefaultPasswordPolicy
+	policy.Breached = breached
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"ok", "correct horse battery staple", nil},
+		{"empty", "", []string{RuleMinLength}},
+		{"short", "abc", []string{RuleMinLength}},
+		{"too many bytes", strings.Repeat("é", 40), []string{RuleMaxLength}},
+		{"email", "Walt@Example.com", []string{RuleNotEmail}},
+		{"email local part", "walt@example.com"[:4], []string{RuleMinLength, RuleNotEmail}},
+		{"breached", "password123", []string{RuleBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policyRules(t, policy.Check(tt.password, "walt@example.com"))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected violations %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("expected default policy to be valid, got %v", err)
+	}
+
+	policy.MaxBytes = BcryptMaxBytes + 1
+	if err := policy.Validate(); err == nil {
+		t.Fatal("expected a limit past bcrypt's to be rejected")
+	}
+
+	policy = DefaultPasswordPolicy
+	policy.MinLength = 0
+	if err := policy.Validate(); err == nil {
+		t.Fatal("expected an empty minimum to be rejected")
+	}
+}
+
+// writeBreachedFile writes the SHA-1 of every password to a sorted corpus
+// file in the HIBP format, with CRLF line endings, and returns its path.
+func writeBreachedFile(t *testing.T, passwords []string) string {
+	t.Helper()
+	hashes := make([]string, 0, len(passwords))
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	sort.Strings(hashes)
+
+	var b strings.Builder
+	b.WriteString("# test corpus\r\n")
+	for i, hash := range hashes {
+		fmt.Fprintf(&b, "%s:%d\r\n", hash, i+1)
+	}
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	return path
+}
+
+func TestBreachedHashFile(t *testing.T) {
+	passwords := []string{"password123"}
+	for i := 0; i < 50000; i++ {
+		passwords = append(passwords, fmt.Sprintf("leaked-%d", i))
+	}
+	path := writeBreachedFile(t, passwords)
+
+	file, err := OpenBreachedHashesFile(path)
+	if err != nil {
+		t.Fatalf("OpenBreachedHashesFile error: %v", err)
+	}
+	defer file.Close()
+
+	// The sorted suffixes under each prefix, as the file should give them.
+	ranges := map[string][]string{}
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		ranges[hash[:5]] = append(ranges[hash[:5]], hash[5:])
+	}
+	for _, suffixes := range ranges {
+		sort.Strings(suffixes)
+	}
+
+	for i := 0; i < len(passwords); i += 97 {
+		breached, err := isBreached(file, passwords[i])
+		if err != nil {
+			t.Fatalf("isBreached error: %v", err)
+		}
+		if !breached {
+			t.Fatalf("expected %q to be found", passwords[i])
+		}
+	}
+	for _, password := range []string{"correct horse battery staple", "leaked-50000", ""} {
+		breached, err := isBreached(file, password)
+		if err != nil {
+			t.Fatalf("isBreached error: %v", err)
+		}
+		if breached {
+			t.Fatalf("expected %q not to be found", password)
+		}
+	}
+
+	// Every range, including the first and last and empty ones, matches
+	// the corpus.
+	for _, prefix := range []string{"00000", "0000A", "7FFFF", "abcde", "FFFFF", "FFFFE"} {
+		got, err := file.Range(prefix)
+		if err != nil {
+			t.Fatalf("Range(%s) error: %v", prefix, err)
+		}
+		want := ranges[strings.ToUpper(prefix)]
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("Range(%s): expected %v, got %v", prefix, want, got)
+		}
+	}
+	for prefix, want := range ranges {
+		got, err := file.Range(prefix)
+		if err != nil {
+			t.Fatalf("Range(%s) error: %v", prefix, err)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("Range(%s): expected %v, got %v", prefix, want, got)
+		}
+	}
+}
+
+func TestOpenBreachedHashesFileRejectsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "garbage.txt")
+	if err := os.WriteFile(path, []byte("not a hash\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	if _, err := OpenBreachedHashesFile(path); err == nil {
+		t.Fatal("expected a file that isn't a hash list to be rejected")
+	}
+}
@@ -0,0 +1,34 @@
+package auth
+
+import "slices"
+
+// Roles a user can hold, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role in rank order.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// RoleAtLeast reports whether role ranks at or above min. It is false
+// when either role is unknown.
+func RoleAtLeast(role, min string) bool {
+	rank, minRank := slices.Index(Roles, role), slices.Index(Roles, min)
+	return rank >= 0 && minRank >= 0 && rank >= minRank
+}
+
+// HasRole reports whether the token was issued to a user holding at least
+// role. Tokens without a role claim are treated as RoleUser.
+func (c *Claims) HasRole(role string) bool {
+	if c.Role == "" {
+		return RoleAtLeast(RoleUser, role)
+	}
+	return RoleAtLeast(c.Role, role)
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, min string
+		want      bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"superuser", RoleUser, false},
+		{RoleAdmin, "superuser", false},
+	}
+	for _, tt := range tests {
+		if got := RoleAtLeast(tt.role, tt.min); got != tt.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestClaimsHasRole(t *testing.T) {
+	keys := newTestKeyring(t, AlgEdDSA)
+
+	token, err := MakeSessionJWT(uuid.New(), uuid.New(), RoleModerator, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT error: %v", err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT error: %v", err)
+	}
+	if !claims.HasRole(RoleModerator) || claims.HasRole(RoleAdmin) {
+		t.Fatalf("unexpected role %q", claims.Role)
+	}
+
+	if roleless := (&Claims{}); !roleless.HasRole(RoleUser) || roleless.HasRole(RoleModerator) {
+		t.Fatal("expected a token without a role claim to be an ordinary user")
+	}
+}
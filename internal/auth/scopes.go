@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes that limit what a delegated token may do.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes lists every scope a token can be granted.
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ValidateScopes checks that scopes is a non-empty list of known scopes.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// FullAccess reports whether the token belongs to a signed-in session
+// rather than being delegated with a limited scope.
+func (c *Claims) FullAccess() bool {
+	return c.Scope == ""
+}
+
+// HasScope reports whether the token may be used for scope. Session tokens
+// may be used for everything.
+func (c *Claims) HasScope(scope string) bool {
+	return c.FullAccess() || slices.Contains(strings.Fields(c.Scope), scope)
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// MakeOpaqueToken returns a random 256-bit token, hex encoded, for one-off
+// secrets such as the links sent by email.
+func MakeOpaqueToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// HashToken returns the SHA-256 digest under which an opaque token is
+// stored, so a database leak does not expose usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can
+// be told apart from JWTs and spotted by secret scanners.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// personalAccessTokenVisible is how many characters of a personal access
+// token are stored in the clear to identify it.
+const personalAccessTokenVisible = len(PersonalAccessTokenPrefix) + 8
+
+// MakePersonalAccessToken returns a new personal access token and the
+// leading part of it that may be shown again later to identify it.
+func MakePersonalAccessToken() (token, prefix string, err error) {
+	secret, err := MakeOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = PersonalAccessTokenPrefix + secret
+	return token, token[:personalAccessTokenVisible], nil
+}
+
+// IsPersonalAccessToken reports whether token looks like one made by
+// MakePersonalAccessToken.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
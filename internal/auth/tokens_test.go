@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashToken(t *testing.T) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("MakeOpaqueToken() error: %v", err)
+	}
+	other, err := MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("MakeOpaqueToken() error: %v", err)
+	}
+	if token == other {
+		t.Fatal("MakeOpaqueToken() returned the same token twice")
+	}
+
+	if HashToken(token) != HashToken(token) {
+		t.Error("HashToken() is not deterministic")
+	}
+	if HashToken(token) == HashToken(other) {
+		t.Error("HashToken() gave two tokens the same hash")
+	}
+	if HashToken(token) == token {
+		t.Error("HashToken() returned the token unchanged")
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, prefix, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error: %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("token %q is not recognized as a personal access token", token)
+	}
+	if !strings.HasPrefix(token, prefix) || len(prefix) >= len(token) {
+		t.Errorf("prefix %q should be a strict prefix of the token", prefix)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJSUzI1NiJ9.e30.sig") {
+		t.Error("a JWT was recognized as a personal access token")
+	}
+}
+
+func TestClaimsHasScope(t *testing.T) {
+	session := &Claims{}
+	if !session.HasScope(ScopeChirpsWrite) {
+		t.Error("session tokens should have every scope")
+	}
+
+	delegated := &Claims{Scope: ScopeChirpsRead + " " + ScopeProfileWrite}
+	if !delegated.HasScope(ScopeProfileWrite) {
+		t.Error("expected a granted scope to be allowed")
+	}
+	if delegated.HasScope(ScopeChirpsWrite) {
+		t.Error("expected a scope that wasn't granted to be refused")
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	if err := ValidateScopes([]string{ScopeChirpsRead, ScopeChirpsWrite}); err != nil {
+		t.Errorf("expected known scopes to be valid, got %v", err)
+	}
+	if err := ValidateScopes(nil); err == nil {
+		t.Error("expected an empty scope list to be rejected")
+	}
+	if err := ValidateScopes([]string{"admin"}); err == nil {
+		t.Error("expected an unknown scope to be rejected")
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC's 8 digit test vectors, truncated to our 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := TOTPCode(rfc6238Secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode error: %v", err)
+	}
+
+	step, ok := ValidateTOTP(rfc6238Secret, code, now, 0)
+	if !ok || step != TOTPStep(now) {
+		t.Fatalf("expected code to validate at step %d, got %d, %v", TOTPStep(now), step, ok)
+	}
+
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now.Add(TOTPPeriod), 0); !ok {
+		t.Error("expected code from the previous step to be accepted")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now.Add(3*TOTPPeriod), 0); ok {
+		t.Error("expected code from three steps ago to be rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now, step); ok {
+		t.Error("expected a used code to be rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "12345", now, 0); ok {
+		t.Error("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret error: %v", err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode error: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, code, now, 0); !ok {
+		t.Fatal("expected generated code to validate")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "user@example.com", rfc6238Secret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("url.Parse error: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Chirpy:user@example.com" {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+	query := u.Query()
+	if query.Get("secret") != rfc6238Secret || query.Get("issuer") != "Chirpy" || query.Get("digits") != "6" {
+		t.Fatalf("unexpected URI parameters %s", u.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	loose := strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))
+	if HashRecoveryCode(loose) != HashRecoveryCode(codes[0]) {
+		t.Error("expected recovery code hash to ignore case and dashes")
+	}
+}
@@ -7,29 +7,67 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const chirpHasQuotes = `-- name: ChirpHasQuotes :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps WHERE quote_of = $1
+)
+`
+
+func (q *Queries) ChirpHasQuotes(ctx context.Context, quoteOf uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpHasQuotes, quoteOf)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const chirpHasReplies = `-- name: ChirpHasReplies :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps WHERE in_reply_to = $1
+)
+`
+
+func (q *Queries) ChirpHasReplies(ctx context.Context, inReplyTo uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpHasReplies, inReplyTo)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.QuoteOf,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +75,47 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
@@ -51,15 +130,363 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
-const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOf)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRechirpsOf = `-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of = $1
+`
+
+func (q *Queries) DeleteRechirpsOf(ctx context.Context, rechirpOf uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirpsOf, rechirpOf)
+	return err
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, 1 AS depth
+    FROM chirps
+    WHERE chirps.id = (SELECT c.in_reply_to FROM chirps c WHERE c.id = $1)
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to
+    WHERE ancestors.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of, depth
+FROM ancestors
+ORDER BY depth DESC
+`
+
+type GetChirpAncestorsParams struct {
+	ChirpID  uuid.UUID
+	MaxDepth int32
+}
+
+type GetChirpAncestorsRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	DeletedAt    sql.NullTime
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	Depth        int32
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ChirpID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, 1 AS depth
+    FROM chirps
+    WHERE chirps.in_reply_to = $1
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+    WHERE descendants.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of, depth
+FROM descendants
+ORDER BY depth ASC, created_at ASC, id ASC
+LIMIT $3
+`
+
+type GetChirpDescendantsParams struct {
+	ChirpID  uuid.NullUUID
+	MaxDepth int32
+	Limit    int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	DeletedAt    sql.NullTime
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	Depth        int32
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, arg.ChirpID, arg.MaxDepth, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($2::boolean OR rechirp_of IS NULL)
+AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) > ($3, $4::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $5::uuid)
+    OR (blocks.blocker_id = $5::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $5::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $6
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	IncludeRechirps bool
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.IncludeRechirps,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
 FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+WHERE deleted_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($2::boolean OR rechirp_of IS NULL)
+AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) < ($3, $4::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $5::uuid)
+    OR (blocks.blocker_id = $5::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $5::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $6
 `
 
-func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, userID)
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	IncludeRechirps bool
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.IncludeRechirps,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +500,11 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -86,3 +518,435 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const listHiddenChirpAuthors = `-- name: ListHiddenChirpAuthors :many
+SELECT id
+FROM hidden_chirp_authors
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) ListHiddenChirpAuthors(ctx context.Context, userIds []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listHiddenChirpAuthors, pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirpsAsc = `-- name: SearchChirpsAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, ts_rank(search_vector, websearch_to_tsquery('english', $1))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', $1)
+AND deleted_at IS NULL
+AND ($2::uuid IS NULL OR user_id = $2)
+AND ($3::timestamp IS NULL OR created_at >= $3)
+AND ($4::timestamp IS NULL OR created_at < $4)
+AND (
+    $5::timestamp IS NULL
+    OR (created_at, id) > ($5, $6::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $7::uuid)
+    OR (blocks.blocker_id = $7::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $7::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $8
+`
+
+type SearchChirpsAscParams struct {
+	Query           string
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsAscRow struct {
+	Chirp Chirp
+	Rank  float32
+}
+
+func (q *Queries) SearchChirpsAsc(ctx context.Context, arg SearchChirpsAscParams) ([]SearchChirpsAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirpsAsc,
+		arg.Query,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsAscRow
+	for rows.Next() {
+		var i SearchChirpsAscRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirpsByRank = `-- name: SearchChirpsByRank :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, ts_rank(search_vector, websearch_to_tsquery('english', $1))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', $1)
+AND deleted_at IS NULL
+AND ($2::uuid IS NULL OR user_id = $2)
+AND ($3::timestamp IS NULL OR created_at >= $3)
+AND ($4::timestamp IS NULL OR created_at < $4)
+AND (
+    $5::real IS NULL
+    OR (ts_rank(search_vector, websearch_to_tsquery('english', $1))::real, created_at, id)
+        < ($5, $6::timestamp, $7::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $8::uuid)
+    OR (blocks.blocker_id = $8::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $8::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $9
+`
+
+type SearchChirpsByRankParams struct {
+	Query           string
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorRank      sql.NullFloat64
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsByRankRow struct {
+	Chirp Chirp
+	Rank  float32
+}
+
+func (q *Queries) SearchChirpsByRank(ctx context.Context, arg SearchChirpsByRankParams) ([]SearchChirpsByRankRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirpsByRank,
+		arg.Query,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorRank,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsByRankRow
+	for rows.Next() {
+		var i SearchChirpsByRankRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirpsByRankReverse = `-- name: SearchChirpsByRankReverse :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, ts_rank(search_vector, websearch_to_tsquery('english', $1))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', $1)
+AND deleted_at IS NULL
+AND ($2::uuid IS NULL OR user_id = $2)
+AND ($3::timestamp IS NULL OR created_at >= $3)
+AND ($4::timestamp IS NULL OR created_at < $4)
+AND (
+    $5::real IS NULL
+    OR (ts_rank(search_vector, websearch_to_tsquery('english', $1))::real, created_at, id)
+        > ($5, $6::timestamp, $7::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $8::uuid)
+    OR (blocks.blocker_id = $8::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $8::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY rank ASC, created_at ASC, id ASC
+LIMIT $9
+`
+
+type SearchChirpsByRankReverseParams struct {
+	Query           string
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorRank      sql.NullFloat64
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsByRankReverseRow struct {
+	Chirp Chirp
+	Rank  float32
+}
+
+func (q *Queries) SearchChirpsByRankReverse(ctx context.Context, arg SearchChirpsByRankReverseParams) ([]SearchChirpsByRankReverseRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirpsByRankReverse,
+		arg.Query,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorRank,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsByRankReverseRow
+	for rows.Next() {
+		var i SearchChirpsByRankReverseRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirpsDesc = `-- name: SearchChirpsDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, ts_rank(search_vector, websearch_to_tsquery('english', $1))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', $1)
+AND deleted_at IS NULL
+AND ($2::uuid IS NULL OR user_id = $2)
+AND ($3::timestamp IS NULL OR created_at >= $3)
+AND ($4::timestamp IS NULL OR created_at < $4)
+AND (
+    $5::timestamp IS NULL
+    OR (created_at, id) < ($5, $6::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $7::uuid)
+    OR (blocks.blocker_id = $7::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = $7::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $8
+`
+
+type SearchChirpsDescParams struct {
+	Query           string
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsDescRow struct {
+	Chirp Chirp
+	Rank  float32
+}
+
+func (q *Queries) SearchChirpsDesc(ctx context.Context, arg SearchChirpsDescParams) ([]SearchChirpsDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirpsDesc,
+		arg.Query,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsDescRow
+	for rows.Next() {
+		var i SearchChirpsDescRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+`
+
+type UpdateChirpBodyParams struct {
+	Body string
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
@@ -11,28 +11,223 @@ import (
 	"github.com/google/uuid"
 )
 
+type AccountStatusEvent struct {
+	ID             uuid.UUID
+	UserID         uuid.UUID
+	ActorID        uuid.NullUUID
+	Status         string
+	Reason         string
+	SuspendedUntil sql.NullTime
+	ChirpsHidden   bool
+	CreatedAt      time.Time
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
-	ID        uuid.UUID
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	DeletedAt    sql.NullTime
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	HashtagID uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
 	UserID    uuid.UUID
+	CreatedAt time.Time
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpMention struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Handle    string
+	CreatedAt time.Time
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Status      string
+	Archive     []byte
+	CreatedAt   time.Time
+	CompletedAt sql.NullTime
+	ExpiresAt   time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Hashtag struct {
+	ID        uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type HiddenChirpAuthor struct {
+	ID uuid.UUID
+}
+
+type LoginLockout struct {
+	ID          uuid.UUID
+	Scope       string
+	Subject     string
+	Failures    int32
+	LockedAt    time.Time
+	LockedUntil time.Time
+}
+
+type LoginThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt sql.NullTime
+	LockedUntil   sql.NullTime
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	FamilyID      uuid.UUID
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+	CreatedAt    time.Time
+}
+
+type OauthConsent struct {
+	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    []string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	ClientID   uuid.NullUUID
+	Scopes     []string
+}
+
+type SigningKey struct {
+	Kid         string
+	Algorithm   string
+	PrivateKey  []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	ActivatesAt time.Time
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	Handle              string
+	EmailVerifiedAt     sql.NullTime
+	Role                string
+	Status              string
+	StatusReason        string
+	SuspendedUntil      sql.NullTime
+	ChirpsHidden        bool
+	DeletionScheduledAt sql.NullTime
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       []byte
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+	CreatedAt    time.Time
 }
@@ -7,26 +7,45 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1
+AND deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(id, created_at, updated_at, email, hashed_password)
+INSERT INTO users(id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password
+RETURNING id, created_at, updated_at, email, hashed_password, handle
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         string
 }
 
 type CreateUserRow struct {
@@ -35,10 +54,11 @@ type CreateUserRow struct {
 	UpdatedAt      time.Time
 	Email          string
 	HashedPassword string
+	Handle         string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
@@ -46,6 +66,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.Handle,
 	)
 	return i, err
 }
@@ -59,43 +80,21 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
-const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id
-FROM chirps
-ORDER BY created_at ASC
+const deleteUsersScheduledBefore = `-- name: DeleteUsersScheduledBefore :execrows
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) DeleteUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUsersScheduledBefore, deletionScheduledAt)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Chirp
-	for rows.Next() {
-		var i Chirp
-		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Body,
-			&i.UserID,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return 0, err
 	}
-	return items, nil
+	return result.RowsAffected()
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
 FROM chirps
 WHERE id = $1
 `
@@ -109,12 +108,42 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const getUserAccountStatus = `-- name: GetUserAccountStatus :one
+SELECT status, status_reason, suspended_until, deletion_scheduled_at
+FROM users
+WHERE id = $1
+`
+
+type GetUserAccountStatusRow struct {
+	Status              string
+	StatusReason        string
+	SuspendedUntil      sql.NullTime
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) GetUserAccountStatus(ctx context.Context, id uuid.UUID) (GetUserAccountStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserAccountStatus, id)
+	var i GetUserAccountStatusRow
+	err := row.Scan(
+		&i.Status,
+		&i.StatusReason,
+		&i.SuspendedUntil,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, role, status, status_reason, suspended_until, chirps_hidden, deletion_scheduled_at
 FROM users
 WHERE email = $1
 `
@@ -129,12 +158,20 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.Status,
+		&i.StatusReason,
+		&i.SuspendedUntil,
+		&i.ChirpsHidden,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, role, status, status_reason, suspended_until, chirps_hidden, deletion_scheduled_at
 FROM users
 WHERE id = $1
 `
@@ -149,47 +186,173 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.Status,
+		&i.StatusReason,
+		&i.SuspendedUntil,
+		&i.ChirpsHidden,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, handle
+FROM users
+WHERE handle = ANY($1::text[])
+`
+
+type GetUsersByHandlesRow struct {
+	ID     uuid.UUID
+	Handle string
+}
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]GetUsersByHandlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByHandlesRow
+	for rows.Next() {
+		var i GetUsersByHandlesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, role, status, status_reason, suspended_until, chirps_hidden, deletion_scheduled_at
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.Status,
+		&i.StatusReason,
+		&i.SuspendedUntil,
+		&i.ChirpsHidden,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = now()
-WHERE id = $3
-RETURNING id, email, created_at, updated_at
+SET
+    email = $1,
+    hashed_password = $2,
+    handle = $3,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+    updated_at = now()
+WHERE id = $4
+RETURNING id, email, handle, created_at, updated_at, email_verified_at
 `
 
 type UpdateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         string
 	ID             uuid.UUID
 }
 
 type UpdateUserRow struct {
-	ID        uuid.UUID
-	Email     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID              uuid.UUID
+	Email           string
+	Handle          string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	EmailVerifiedAt sql.NullTime
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.ID,
+	)
 	var i UpdateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.Email,
+		&i.Handle,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
 const upgradeUsertoChirpyRed = `-- name: UpgradeUsertoChirpyRed :one
 UPDATE users
 SET is_chirpy_red = true, updated_at = now()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, email_verified_at, role, status, status_reason, suspended_until, chirps_hidden, deletion_scheduled_at
 `
 
 func (q *Queries) UpgradeUsertoChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -202,6 +365,14 @@ func (q *Queries) UpgradeUsertoChirpyRed(ctx context.Context, id uuid.UUID) (Use
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.Status,
+		&i.StatusReason,
+		&i.SuspendedUntil,
+		&i.ChirpsHidden,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
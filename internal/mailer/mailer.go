@@ -0,0 +1,69 @@
+// Package mailer sends transactional email such as verification links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer delivers messages through an SMTP relay.
+type SMTPMailer struct {
+	addr string
+	from string
+	// sender is the bare address from From, used as the envelope sender.
+	sender string
+	auth   smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer relaying through host:port. from may
+// include a display name, as in "Chirpy <no-reply@example.com>".
+// Credentials are optional; when given, PLAIN auth is used, which
+// net/smtp only allows over TLS or to localhost.
+func NewSMTPMailer(host, port, username, password, from string) (*SMTPMailer, error) {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", from, err)
+	}
+	m := &SMTPMailer{addr: host + ":" + port, from: from, sender: addr.Address}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.sender, []string{msg.To}, format(m.from, msg, time.Now()))
+}
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import "testing"
+
+func TestNewSMTPMailerUsesBareEnvelopeSender(t *testing.T) {
+	m, err := NewSMTPMailer("localhost", "25", "", "", "Chirpy <no-reply@chirpy.local>")
+	if err != nil {
+		t.Fatalf("NewSMTPMailer error: %v", err)
+	}
+	if m.sender != "no-reply@chirpy.local" {
+		t.Fatalf("expected envelope sender no-reply@chirpy.local, got %q", m.sender)
+	}
+	if m.from != "Chirpy <no-reply@chirpy.local>" {
+		t.Fatalf("expected From header to keep the display name, got %q", m.from)
+	}
+}
+
+func TestNewSMTPMailerRejectsInvalidFrom(t *testing.T) {
+	if _, err := NewSMTPMailer("localhost", "25", "", "", "not an address"); err == nil {
+		t.Fatal("expected an invalid from address to be rejected")
+	}
+}
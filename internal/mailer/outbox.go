@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps sent messages instead of delivering them, for development
+// and tests. When created with a directory it also writes each message
+// there as an .eml file so it can be opened in a mail client.
+type Outbox struct {
+	mu       sync.Mutex
+	dir      string
+	from     string
+	messages []Message
+}
+
+// NewOutbox returns an outbox writing to dir, or keeping messages only in
+// memory when dir is empty.
+func NewOutbox(dir, from string) (*Outbox, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &Outbox{dir: dir, from: from}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.dir != "" {
+		now := time.Now()
+		name := fmt.Sprintf("%s-%03d.eml", now.UTC().Format("20060102T150405.000000000"), len(o.messages))
+		if err := os.WriteFile(filepath.Join(o.dir, name), format(o.from, msg, now), 0o600); err != nil {
+			return err
+		}
+	}
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOutboxKeepsMessages(t *testing.T) {
+	outbox, err := NewOutbox("", "chirpy@example.com")
+	if err != nil {
+		t.Fatalf("NewOutbox error: %v", err)
+	}
+
+	msg := Message{To: "user@example.com", Subject: "Hello", Body: "Hi there"}
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	sent := outbox.Messages()
+	if len(sent) != 1 || sent[0] != msg {
+		t.Fatalf("expected outbox to hold %v, got %v", msg, sent)
+	}
+}
+
+func TestOutboxWritesFiles(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewOutbox(dir, "chirpy@example.com")
+	if err != nil {
+		t.Fatalf("NewOutbox error: %v", err)
+	}
+
+	err = outbox.Send(context.Background(), Message{To: "user@example.com", Subject: "Verify", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(entries))
+	}
+
+	data, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	for _, want := range []string{"From: chirpy@example.com\r\n", "To: user@example.com\r\n", "Subject: Verify\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected message to contain %q, got:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package throttle
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMemoryLockouts bounds how many lockout records a MemoryStore keeps.
+const maxMemoryLockouts = 1000
+
+// MemoryStore keeps throttle state in process. It is safe for concurrent
+// use but not shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	states   map[string]State
+	lockouts []Lockout
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]State{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, fn func(State) State) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := fn(s.states[key])
+	s.states[key] = state
+	return state, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, prefix string, staleBefore, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, state := range s.states {
+		if strings.HasPrefix(key, prefix) && !state.LastFailureAt.After(staleBefore) && !now.Before(state.LockedUntil) {
+			delete(s.states, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) RecordLockout(ctx context.Context, lockout Lockout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockouts = append(s.lockouts, lockout)
+	if len(s.lockouts) > maxMemoryLockouts {
+		s.lockouts = s.lockouts[len(s.lockouts)-maxMemoryLockouts:]
+	}
+	return nil
+}
+
+func (s *MemoryStore) Lockouts(ctx context.Context, limit int) ([]Lockout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lockouts := make([]Lockout, 0, min(limit, len(s.lockouts)))
+	for i := len(s.lockouts) - 1; i >= 0 && len(lockouts) < limit; i-- {
+		lockouts = append(lockouts, s.lockouts[i])
+	}
+	return lockouts, nil
+}
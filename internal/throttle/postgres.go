@@ -0,0 +1,113 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+)
+
+// PostgresStore keeps throttle state in Postgres so every instance sees
+// the same failures and lockouts.
+type PostgresStore struct {
+	conn *sql.DB
+	db   *database.Queries
+}
+
+func NewPostgresStore(conn *sql.DB) *PostgresStore {
+	return &PostgresStore{conn: conn, db: database.New(conn)}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (State, error) {
+	row, err := s.db.GetLoginThrottle(ctx, key)
+	if err == sql.ErrNoRows {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	return stateFromRow(row), nil
+}
+
+func (s *PostgresStore) Update(ctx context.Context, key string, fn func(State) State) (State, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return State{}, err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	if err := qtx.EnsureLoginThrottle(ctx, key); err != nil {
+		return State{}, err
+	}
+	row, err := qtx.GetLoginThrottleForUpdate(ctx, key)
+	if err != nil {
+		return State{}, err
+	}
+
+	state := fn(stateFromRow(row))
+	err = qtx.UpdateLoginThrottle(ctx, database.UpdateLoginThrottleParams{
+		Key:           key,
+		Failures:      int32(state.Failures),
+		LastFailureAt: nullTime(state.LastFailureAt),
+		LockedUntil:   nullTime(state.LockedUntil),
+	})
+	if err != nil {
+		return State{}, err
+	}
+
+	return state, tx.Commit()
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	return s.db.DeleteLoginThrottle(ctx, key)
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, prefix string, staleBefore, now time.Time) error {
+	return s.db.DeleteStaleLoginThrottles(ctx, database.DeleteStaleLoginThrottlesParams{
+		Prefix:      prefix,
+		StaleBefore: staleBefore,
+		Now:         now,
+	})
+}
+
+func (s *PostgresStore) RecordLockout(ctx context.Context, lockout Lockout) error {
+	return s.db.CreateLoginLockout(ctx, database.CreateLoginLockoutParams{
+		Scope:       lockout.Scope,
+		Subject:     lockout.Subject,
+		Failures:    int32(lockout.Failures),
+		LockedAt:    lockout.LockedAt,
+		LockedUntil: lockout.LockedUntil,
+	})
+}
+
+func (s *PostgresStore) Lockouts(ctx context.Context, limit int) ([]Lockout, error) {
+	rows, err := s.db.ListLoginLockouts(ctx, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	lockouts := make([]Lockout, 0, len(rows))
+	for _, row := range rows {
+		lockouts = append(lockouts, Lockout{
+			Scope:       row.Scope,
+			Subject:     row.Subject,
+			Failures:    int(row.Failures),
+			LockedAt:    row.LockedAt,
+			LockedUntil: row.LockedUntil,
+		})
+	}
+	return lockouts, nil
+}
+
+func stateFromRow(row database.LoginThrottle) State {
+	return State{
+		Failures:      int(row.Failures),
+		LastFailureAt: row.LastFailureAt.Time,
+		LockedUntil:   row.LockedUntil.Time,
+	}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,243 @@
+// Package throttle slows down and locks out repeated failures, such as
+// password guesses, per account or per client address.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Policy describes how failures for one kind of key are punished.
+type Policy struct {
+	// FreeAttempts failures are allowed back to back before backoff starts.
+	FreeAttempts int
+	// BaseDelay is the wait imposed after the first failure past the free
+	// attempts. It doubles with every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutThreshold failures lock the key out for LockoutDuration. Zero
+	// disables lockouts.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// ResetAfter forgets failures once none have happened for this long.
+	ResetAfter time.Duration
+}
+
+// State is what a store keeps for a key.
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Lockout records a key being locked out, for admins to review.
+type Lockout struct {
+	Scope       string    `json:"scope"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LockedAt    time.Time `json:"locked_at"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Store persists throttle state. MemoryStore suits a single instance;
+// PostgresStore shares state between instances.
+type Store interface {
+	// Get returns the state for key, or the zero State if there is none.
+	Get(ctx context.Context, key string) (State, error)
+	// Update replaces the state for key with fn applied to it, atomically
+	// with respect to other updates of the same key.
+	Update(ctx context.Context, key string, fn func(State) State) (State, error)
+	Delete(ctx context.Context, key string) error
+	// Prune drops state for keys starting with prefix that last failed no
+	// later than staleBefore and aren't locked at now.
+	Prune(ctx context.Context, prefix string, staleBefore, now time.Time) error
+
+	RecordLockout(ctx context.Context, lockout Lockout) error
+	// Lockouts returns the most recent lockouts, newest first.
+	Lockouts(ctx context.Context, limit int) ([]Lockout, error)
+}
+
+// Limiter applies a policy to the keys in one scope, such as accounts or
+// client addresses.
+type Limiter struct {
+	store  Store
+	scope  string
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, scope string, policy Policy) *Limiter {
+	return &Limiter{store: store, scope: scope, policy: policy, now: time.Now}
+}
+
+func (l *Limiter) key(subject string) string {
+	return l.scope + ":" + subject
+}
+
+// Check returns how long subject must wait before its next attempt, or zero
+// if it may try now.
+func (l *Limiter) Check(ctx context.Context, subject string) (time.Duration, error) {
+	state, err := l.store.Get(ctx, l.key(subject))
+	if err != nil {
+		return 0, err
+	}
+	return l.wait(state, l.now().UTC()), nil
+}
+
+func (l *Limiter) wait(state State, now time.Time) time.Duration {
+	if now.Before(state.LockedUntil) {
+		return state.LockedUntil.Sub(now)
+	}
+	if l.expired(state, now) {
+		return 0
+	}
+	if next := state.LastFailureAt.Add(l.delay(state.Failures)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// delay is the backoff imposed after the given number of failures.
+func (l *Limiter) delay(failures int) time.Duration {
+	over := failures - l.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := l.policy.BaseDelay
+	for i := 1; i < over; i++ {
+		delay *= 2
+		if delay >= l.policy.MaxDelay {
+			return l.policy.MaxDelay
+		}
+	}
+	return min(delay, l.policy.MaxDelay)
+}
+
+func (l *Limiter) expired(state State, now time.Time) bool {
+	return l.policy.ResetAfter > 0 && !now.Before(state.LastFailureAt.Add(l.policy.ResetAfter))
+}
+
+// Fail records a failed attempt by subject. It returns how long subject
+// must now wait, and whether this failure locked it out.
+func (l *Limiter) Fail(ctx context.Context, subject string) (time.Duration, bool, error) {
+	now := l.now().UTC()
+	locked := false
+
+	state, err := l.store.Update(ctx, l.key(subject), func(state State) State {
+		if l.expired(state, now) && !now.Before(state.LockedUntil) {
+			state = State{}
+		}
+		state.Failures++
+		state.LastFailureAt = now
+		if l.policy.LockoutThreshold > 0 && state.Failures >= l.policy.LockoutThreshold {
+			// Backoff starts over once the lockout ends.
+			locked = true
+			state.LockedUntil = now.Add(l.policy.LockoutDuration)
+			state.Failures = 0
+		}
+		return state
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if locked {
+		err := l.store.RecordLockout(ctx, Lockout{
+			Scope:       l.scope,
+			Subject:     subject,
+			Failures:    l.policy.LockoutThreshold,
+			LockedAt:    now,
+			LockedUntil: state.LockedUntil,
+		})
+		if err != nil {
+			return 0, true, err
+		}
+	}
+	return l.wait(state, now), locked, nil
+}
+
+// Reserve claims an attempt for subject before its outcome is known,
+// counting it as a failure up front so that a burst of parallel attempts
+// can't all get past the backoff before any of them fails. If subject
+// must wait, nothing is claimed and the wait is returned; otherwise it is
+// zero and the caller should Release the attempt if it succeeds. Once
+// LockoutThreshold attempts have been claimed, the next one locks subject
+// out, and locked reports whether this call did so.
+func (l *Limiter) Reserve(ctx context.Context, subject string) (time.Duration, bool, error) {
+	now := l.now().UTC()
+	locked := false
+	var wait time.Duration
+
+	state, err := l.store.Update(ctx, l.key(subject), func(state State) State {
+		if l.expired(state, now) && !now.Before(state.LockedUntil) {
+			state = State{}
+		}
+		if wait = l.wait(state, now); wait > 0 {
+			return state
+		}
+		if l.policy.LockoutThreshold > 0 && state.Failures >= l.policy.LockoutThreshold {
+			locked = true
+			state.LockedUntil = now.Add(l.policy.LockoutDuration)
+			state.Failures = 0
+			wait = l.policy.LockoutDuration
+			return state
+		}
+		state.Failures++
+		state.LastFailureAt = now
+		return state
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if locked {
+		err := l.store.RecordLockout(ctx, Lockout{
+			Scope:       l.scope,
+			Subject:     subject,
+			Failures:    l.policy.LockoutThreshold,
+			LockedAt:    now,
+			LockedUntil: state.LockedUntil,
+		})
+		if err != nil {
+			return wait, true, err
+		}
+	}
+	return wait, locked, nil
+}
+
+// Release gives back an attempt claimed with Reserve that turned out to
+// succeed, so it no longer counts as a failure.
+func (l *Limiter) Release(ctx context.Context, subject string) error {
+	_, err := l.store.Update(ctx, l.key(subject), func(state State) State {
+		if state.Failures > 0 {
+			state.Failures--
+		}
+		return state
+	})
+	return err
+}
+
+// Succeed forgets subject's failures after a successful attempt. It does
+// not lift a lockout early.
+func (l *Limiter) Succeed(ctx context.Context, subject string) error {
+	now := l.now().UTC()
+	state, err := l.store.Get(ctx, l.key(subject))
+	if err != nil {
+		return err
+	}
+	if now.Before(state.LockedUntil) || (state == State{}) {
+		return nil
+	}
+	return l.store.Delete(ctx, l.key(subject))
+}
+
+// Unlock clears subject's failures and any lockout.
+func (l *Limiter) Unlock(ctx context.Context, subject string) error {
+	return l.store.Delete(ctx, l.key(subject))
+}
+
+// Prune drops state this limiter's policy has already forgotten.
+func (l *Limiter) Prune(ctx context.Context) error {
+	now := l.now().UTC()
+	return l.store.Prune(ctx, l.key(""), now.Add(-l.policy.ResetAfter), now)
+}
@@ -0,0 +1,236 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:     2,
+	BaseDelay:        time.Second,
+	MaxDelay:         4 * time.Second,
+	LockoutThreshold: 6,
+	LockoutDuration:  time.Minute,
+	ResetAfter:       time.Hour,
+}
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestLimiter(store Store) (*Limiter, *testClock) {
+	clock := &testClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(store, "account", testPolicy)
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	ctx := context.Background()
+	limiter, clock := newTestLimiter(NewMemoryStore())
+
+	// The free attempts impose no wait; each failure after doubles it.
+	wants := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second}
+	for i, want := range wants {
+		wait, locked, err := limiter.Fail(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("Fail error: %v", err)
+		}
+		if locked {
+			t.Fatalf("failure %d locked the account early", i+1)
+		}
+		if wait != want {
+			t.Fatalf("failure %d: expected wait %s, got %s", i+1, want, wait)
+		}
+		clock.now = clock.now.Add(wait)
+	}
+
+	wait, err := limiter.Check(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if wait != 0 {
+		t.Fatalf("expected no wait once the backoff passed, got %s", wait)
+	}
+
+	if wait, _ := limiter.Check(ctx, "other@example.com"); wait != 0 {
+		t.Fatalf("expected other subjects to be unaffected, got %s", wait)
+	}
+}
+
+func TestLimiterMaxDelay(t *testing.T) {
+	limiter, _ := newTestLimiter(NewMemoryStore())
+	if got := limiter.delay(50); got != testPolicy.MaxDelay {
+		t.Fatalf("expected delay capped at %s, got %s", testPolicy.MaxDelay, got)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limiter, clock := newTestLimiter(store)
+
+	var locked bool
+	for i := 0; i < testPolicy.LockoutThreshold; i++ {
+		var err error
+		_, locked, err = limiter.Fail(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("Fail error: %v", err)
+		}
+	}
+	if !locked {
+		t.Fatal("expected the last failure to lock the account")
+	}
+
+	wait, err := limiter.Check(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if wait != testPolicy.LockoutDuration {
+		t.Fatalf("expected wait %s, got %s", testPolicy.LockoutDuration, wait)
+	}
+
+	// A success during the lockout doesn't lift it.
+	if err := limiter.Succeed(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Succeed error: %v", err)
+	}
+	if wait, _ := limiter.Check(ctx, "user@example.com"); wait == 0 {
+		t.Fatal("expected the lockout to survive a success")
+	}
+
+	lockouts, err := store.Lockouts(ctx, 10)
+	if err != nil {
+		t.Fatalf("Lockouts error: %v", err)
+	}
+	if len(lockouts) != 1 || lockouts[0].Scope != "account" || lockouts[0].Subject != "user@example.com" {
+		t.Fatalf("unexpected lockouts %+v", lockouts)
+	}
+
+	clock.now = clock.now.Add(testPolicy.LockoutDuration)
+	if wait, _ := limiter.Check(ctx, "user@example.com"); wait != 0 {
+		t.Fatalf("expected the lockout to end, got wait %s", wait)
+	}
+}
+
+func TestLimiterSucceedResets(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(NewMemoryStore())
+
+	for i := 0; i < 4; i++ {
+		limiter.Fail(ctx, "user@example.com")
+	}
+	if err := limiter.Succeed(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Succeed error: %v", err)
+	}
+	if wait, _ := limiter.Check(ctx, "user@example.com"); wait != 0 {
+		t.Fatalf("expected no wait after a success, got %s", wait)
+	}
+}
+
+func TestLimiterForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limiter, clock := newTestLimiter(store)
+
+	for i := 0; i < 4; i++ {
+		limiter.Fail(ctx, "user@example.com")
+	}
+	clock.now = clock.now.Add(testPolicy.ResetAfter)
+
+	wait, _, err := limiter.Fail(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("Fail error: %v", err)
+	}
+	if wait != 0 {
+		t.Fatalf("expected old failures to be forgotten, got wait %s", wait)
+	}
+
+	clock.now = clock.now.Add(testPolicy.ResetAfter)
+	if err := limiter.Prune(ctx); err != nil {
+		t.Fatalf("Prune error: %v", err)
+	}
+	if state, _ := store.Get(ctx, "account:user@example.com"); state != (State{}) {
+		t.Fatalf("expected stale state to be pruned, got %+v", state)
+	}
+}
+
+func TestLimiterReserveLimitsParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(NewMemoryStore())
+
+	// A burst of simultaneous attempts gets the free attempts plus the
+	// one that starts the backoff, however many are sent.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, _, err := limiter.Reserve(ctx, "user@example.com")
+			if err != nil {
+				t.Errorf("Reserve error: %v", err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := testPolicy.FreeAttempts + 1; allowed != want {
+		t.Fatalf("expected %d attempts to be allowed, got %d", want, allowed)
+	}
+}
+
+func TestLimiterReserveLocksOut(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limiter, clock := newTestLimiter(store)
+
+	for i := 0; i < testPolicy.LockoutThreshold; i++ {
+		wait, locked, err := limiter.Reserve(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("Reserve error: %v", err)
+		}
+		if wait != 0 || locked {
+			t.Fatalf("attempt %d: expected to be allowed, got wait %s, locked %v", i+1, wait, locked)
+		}
+		clock.now = clock.now.Add(testPolicy.MaxDelay)
+	}
+
+	wait, locked, err := limiter.Reserve(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("Reserve error: %v", err)
+	}
+	if !locked || wait != testPolicy.LockoutDuration {
+		t.Fatalf("expected the attempt past the threshold to lock out for %s, got wait %s, locked %v", testPolicy.LockoutDuration, wait, locked)
+	}
+	if lockouts, _ := store.Lockouts(ctx, 10); len(lockouts) != 1 {
+		t.Fatalf("expected one lockout to be recorded, got %+v", lockouts)
+	}
+}
+
+func TestLimiterReleaseReturnsAttempt(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(NewMemoryStore())
+
+	// Successful attempts given back never build up a backoff.
+	for i := 0; i < 10; i++ {
+		wait, _, err := limiter.Reserve(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("Reserve error: %v", err)
+		}
+		if wait != 0 {
+			t.Fatalf("attempt %d: expected no wait, got %s", i+1, wait)
+		}
+		if err := limiter.Release(ctx, "user@example.com"); err != nil {
+			t.Fatalf("Release error: %v", err)
+		}
+	}
+}
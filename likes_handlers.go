@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(w, r, userID, restrictLike) {
+		return
+	}
+
+	// Liking a plain rechirp likes the chirp it shares.
+	chirp, err := cfg.resolveSharedChirp(r.Context(), cfg.db, userID, chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Chirp not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: chirp.ID,
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Chirp not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if chirp.RechirpOf.Valid {
+		chirp.ID = chirp.RechirpOf.UUID
+	}
+
+	err = cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirp.ID,
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Printf("Error unliking chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
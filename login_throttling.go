@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/throttle"
+)
+
+// Failed logins are throttled per account, against guessing one user's
+// password, and per client address, against trying a few passwords on
+// many accounts.
+var (
+	accountLoginPolicy = throttle.Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+	addressLoginPolicy = throttle.Policy{
+		FreeAttempts:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  time.Hour,
+		ResetAfter:       time.Hour,
+	}
+)
+
+const (
+	throttlePruneInterval = 10 * time.Minute
+	defaultLockoutsLimit  = 50
+	maxLockoutsLimit      = 500
+)
+
+// loginAccount is the throttling subject for a login email.
+func loginAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// respondTooManyRequests writes a 429 telling the client to retry after wait.
+func respondTooManyRequests(w http.ResponseWriter, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, message, nil)
+}
+
+// reserveLoginAttempt claims a login attempt for account from the
+// request's address before the credentials are checked. The attempt counts
+// as a failure unless releaseLoginAttempt gives it back, so parallel
+// guesses can't all get in before the first one fails. If either limit is
+// reached it writes a 429 and returns false.
+func (cfg *apiConfig) reserveLoginAttempt(w http.ResponseWriter, r *http.Request, account string) bool {
+	address := clientIP(r)
+
+	accountWait, locked, err := cfg.loginAccounts.Reserve(r.Context(), account)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return false
+	}
+	if locked {
+		log.Printf("Locked out account %s after repeated failed logins", account)
+	}
+	if accountWait > 0 {
+		respondTooManyRequests(w, accountWait, "Too many failed login attempts, try again later")
+		return false
+	}
+
+	addressWait, locked, err := cfg.loginAddresses.Reserve(r.Context(), address)
+	if err == nil && locked {
+		log.Printf("Locked out address %s after repeated failed logins", address)
+	}
+	if err != nil || addressWait > 0 {
+		// The account's attempt never happened.
+		if err := cfg.loginAccounts.Release(r.Context(), account); err != nil {
+			log.Printf("Error releasing login attempt: %s", err)
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return false
+	}
+	if addressWait > 0 {
+		respondTooManyRequests(w, addressWait, "Too many failed login attempts, try again later")
+		return false
+	}
+	return true
+}
+
+// releaseLoginAttempt gives back an attempt claimed by reserveLoginAttempt
+// once the credentials proved correct. Errors are logged rather than
+// failing the request.
+func (cfg *apiConfig) releaseLoginAttempt(r *http.Request, account string) {
+	if err := cfg.loginAccounts.Release(r.Context(), account); err != nil {
+		log.Printf("Error releasing login attempt: %s", err)
+	}
+	if err := cfg.loginAddresses.Release(r.Context(), clientIP(r)); err != nil {
+		log.Printf("Error releasing login attempt: %s", err)
+	}
+}
+
+// recordLoginSuccess clears account's failures. The address keeps its
+// count, or an attacker could reset it by signing into their own account
+// between guesses.
+func (cfg *apiConfig) recordLoginSuccess(r *http.Request, account string) {
+	if err := cfg.loginAccounts.Succeed(r.Context(), account); err != nil {
+		log.Printf("Error clearing failed logins: %s", err)
+	}
+}
+
+// runThrottlePruning drops stale login throttling state until ctx is done.
+func (cfg *apiConfig) runThrottlePruning(ctx context.Context) {
+	ticker := time.NewTicker(throttlePruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, limiter := range []*throttle.Limiter{cfg.loginAccounts, cfg.loginAddresses} {
+				if err := limiter.Prune(ctx); err != nil {
+					log.Printf("Error pruning login throttles: %s", err)
+				}
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerAdminLockouts(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLockoutsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLockoutsLimit {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLockoutsLimit), nil)
+			return
+		}
+		limit = parsed
+	}
+
+	lockouts, err := cfg.throttleStore.Lockouts(r.Context(), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list lockouts", err)
+		return
+	}
+	sendJSONResponse(w, lockouts, http.StatusOK)
+}
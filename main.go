@@ -1,34 +1,59 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/SethGK/chirpy/internal/auth"
 	"github.com/SethGK/chirpy/internal/database"
+	"github.com/SethGK/chirpy/internal/mailer"
+	"github.com/SethGK/chirpy/internal/throttle"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	dbConn         *sql.DB
 	platform       string
 	jwtSecret      string
+	jwtKeys        *auth.Keyring
+	jwtAlgorithm   string
+	jwtKeyRotation time.Duration
+	passwords      *auth.Passwords
+	passwordPolicy auth.PasswordPolicy
 	polkaKey       string
+	mailer         mailer.Mailer
+	throttleStore  throttle.Store
+	loginAccounts  *throttle.Limiter
+	loginAddresses *throttle.Limiter
+	// deletionGracePeriod is how long deleted accounts wait before they
+	// are purged.
+	deletionGracePeriod time.Duration
+	// dataExportSlots holds a token for each background data export
+	// running, up to maxConcurrentDataExports.
+	dataExportSlots chan struct{}
+	// unverifiedRestrictions holds the actions users may not take until
+	// they verify their email address.
+	unverifiedRestrictions map[string]bool
 }
 
 type CreateUserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Handle   string `json:"handle"`
 }
 
 type User struct {
@@ -36,8 +61,10 @@ type User struct {
 	CreatedAt      time.Time `json:"created_at"`
 	UpdateAt       time.Time `json:"updated_at"`
 	Email          string    `json:"email"`
+	Handle         string    `json:"handle"`
 	HashedPassword string    `json:"-"`
 	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	EmailVerified  bool      `json:"email_verified"`
 }
 
 type ChirpRequest struct {
@@ -45,15 +72,28 @@ type ChirpRequest struct {
 }
 
 type CreateChirpRequest struct {
-	Body string `json:"body"`
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Body      string          `json:"body"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Hashtags  []HashtagEntity `json:"hashtags"`
+	Mentions  []MentionEntity `json:"mentions"`
+	LikeCount int64           `json:"like_count"`
+	LikedByMe bool            `json:"liked_by_me"`
+	InReplyTo *uuid.UUID      `json:"in_reply_to"`
+	RechirpOf *uuid.UUID      `json:"rechirp_of"`
+	QuoteOf   *uuid.UUID      `json:"quote_of"`
+	// Original is the chirp shared by a rechirp or quote.
+	Original *Chirp `json:"original,omitempty"`
+	// Deleted marks a tombstone left in a thread by a deleted chirp.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -66,6 +106,8 @@ type SuccessResponse struct {
 
 var profaneWords = []string{"kerfuffle", "sharbert", "fornax"}
 
+const maxChirpLength = 140
+
 func main() {
 
 	err := godotenv.Load()
@@ -100,13 +142,149 @@ func main() {
 		log.Fatal("POLKA_KEY is not set in .env")
 	}
 
+	jwtAlgorithm := os.Getenv("JWT_SIGNING_ALGORITHM")
+	if jwtAlgorithm == "" {
+		jwtAlgorithm = auth.AlgRS256
+	}
+	if jwtAlgorithm != auth.AlgRS256 && jwtAlgorithm != auth.AlgEdDSA {
+		log.Fatalf("JWT_SIGNING_ALGORITHM must be %s or %s", auth.AlgRS256, auth.AlgEdDSA)
+	}
+
+	jwtKeyRotation := defaultKeyRotationInterval
+	if rotation := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); rotation != "" {
+		jwtKeyRotation, err = time.ParseDuration(rotation)
+		if err != nil || jwtKeyRotation <= 0 {
+			log.Fatal("JWT_KEY_ROTATION_INTERVAL must be a positive duration")
+		}
+	}
+
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "chirpy"
+	}
+
+	jwtLeeway := auth.DefaultLeeway
+	if leeway := os.Getenv("JWT_LEEWAY"); leeway != "" {
+		jwtLeeway, err = time.ParseDuration(leeway)
+		if err != nil {
+			log.Fatal("JWT_LEEWAY must be a duration")
+		}
+	}
+
+	jwtKeys := auth.NewKeyring()
+	if err := jwtKeys.Configure(jwtAudience, jwtLeeway); err != nil {
+		log.Fatalf("Invalid JWT settings: %s", err)
+	}
+
+	// An empty UNVERIFIED_USER_RESTRICTIONS lifts every restriction, so only
+	// fall back to the default when it isn't set at all.
+	restrictions, ok := os.LookupEnv("UNVERIFIED_USER_RESTRICTIONS")
+	if !ok {
+		restrictions = restrictChirp
+	}
+	unverifiedRestrictions, err := parseRestrictions(restrictions)
+	if err != nil {
+		log.Fatalf("Invalid UNVERIFIED_USER_RESTRICTIONS: %s", err)
+	}
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	var mailSender mailer.Mailer
+	switch os.Getenv("MAILER") {
+	case "", "outbox":
+		outboxDir := os.Getenv("OUTBOX_DIR")
+		if outboxDir == "" {
+			outboxDir = "outbox"
+		}
+		mailSender, err = mailer.NewOutbox(outboxDir, mailFrom)
+		if err != nil {
+			log.Fatalf("Error creating outbox: %s", err)
+		}
+	case "smtp":
+		smtpHost := os.Getenv("SMTP_HOST")
+		if smtpHost == "" {
+			log.Fatal("SMTP_HOST is not set in .env")
+		}
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		mailSender, err = mailer.NewSMTPMailer(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+		if err != nil {
+			log.Fatalf("Invalid MAIL_FROM: %s", err)
+		}
+	default:
+		log.Fatal("MAILER must be smtp or outbox")
+	}
+
+	passwords, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Invalid password hashing settings: %s", err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Invalid password policy settings: %s", err)
+	}
+
+	deletionGracePeriod := defaultDeletionGracePeriod
+	if grace := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"); grace != "" {
+		deletionGracePeriod, err = time.ParseDuration(grace)
+		if err != nil || deletionGracePeriod < 0 {
+			log.Fatal("ACCOUNT_DELETION_GRACE_PERIOD must be a duration of at least 0")
+		}
+	}
+
+	var throttleStore throttle.Store
+	switch os.Getenv("LOGIN_THROTTLE_STORE") {
+	case "", "memory":
+		throttleStore = throttle.NewMemoryStore()
+	case "postgres":
+		throttleStore = throttle.NewPostgresStore(db)
+	default:
+		log.Fatal("LOGIN_THROTTLE_STORE must be memory or postgres")
+	}
+
 	apiCfg := apiConfig{
-		db:        dbQueries,
-		platform:  platform,
-		jwtSecret: jwtSecret,
-		polkaKey:  polkaKey,
+		db:             dbQueries,
+		dbConn:         db,
+		platform:       platform,
+		jwtSecret:      jwtSecret,
+		jwtKeys:        jwtKeys,
+		jwtAlgorithm:   jwtAlgorithm,
+		jwtKeyRotation: jwtKeyRotation,
+		passwords:      passwords,
+		passwordPolicy: passwordPolicy,
+		polkaKey:       polkaKey,
+		mailer:         mailSender,
+		throttleStore:  throttleStore,
+		loginAccounts:  throttle.NewLimiter(throttleStore, "account", accountLoginPolicy),
+		loginAddresses: throttle.NewLimiter(throttleStore, "address", addressLoginPolicy),
+
+		deletionGracePeriod: deletionGracePeriod,
+		dataExportSlots:     make(chan struct{}, maxConcurrentDataExports),
+
+		unverifiedRestrictions: unverifiedRestrictions,
 	}
 
+	if err := apiCfg.loadSigningKeys(context.Background()); err != nil {
+		log.Fatalf("Error loading signing keys: %s", err)
+	}
+	if err := apiCfg.rotateSigningKeys(context.Background()); err != nil {
+		log.Fatalf("Error creating signing key: %s", err)
+	}
+	if email := os.Getenv("BOOTSTRAP_ADMIN_EMAIL"); email != "" {
+		if err := apiCfg.bootstrapAdmin(context.Background(), email); err != nil {
+			log.Fatalf("Error promoting bootstrap admin: %s", err)
+		}
+	}
+	go apiCfg.runKeyRotation(context.Background())
+	go apiCfg.runThrottlePruning(context.Background())
+	go apiCfg.runAccountPurge(context.Background())
+
 	const filepathRoot = "."
 	const port = "8080"
 
@@ -114,11 +292,21 @@ func main() {
 
 	fileServer := http.FileServer(http.Dir(filepathRoot))
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", fileServer)))
+	mux.Handle(consentPagePath, apiCfg.middlewareMetricsInc(http.HandlerFunc(apiCfg.handlerOAuthConsentPage)))
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerAdminMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerAdminReset)
+	mux.Handle("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminMetrics)))
+	mux.Handle("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminReset)))
+	mux.Handle("GET /admin/lockouts", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.handlerAdminLockouts)))
+	mux.Handle("GET /admin/users", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.handlerAdminListUsers)))
+	mux.Handle("PUT /admin/users/{userID}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminSetRole)))
+	mux.Handle("POST /admin/users/{userID}/suspend", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.handlerAdminSuspendUser)))
+	mux.Handle("POST /admin/users/{userID}/ban", apiCfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(apiCfg.handlerAdminBanUser)))
+	mux.Handle("POST /admin/users/{userID}/reinstate", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.handlerAdminReinstateUser)))
+	mux.Handle("GET /admin/users/{userID}/status-history", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.handlerAdminStatusHistory)))
+	mux.Handle("POST /admin/users/{userID}/logout", apiCfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(apiCfg.handlerAdminLogoutUser)))
 
 	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
 		handlerCreateChirp(&apiCfg, w, r)
@@ -130,6 +318,16 @@ func main() {
 	mux.HandleFunc("GET /api/chirps/", func(w http.ResponseWriter, r *http.Request) {
 		apiCfg.handlerGetChirp(w, r)
 	})
+	mux.HandleFunc("GET /api/chirps/search", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerSearchChirps(w, r)
+	})
+
+	mux.HandleFunc("GET /api/hashtags/trending", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetTrendingHashtags(w, r)
+	})
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetHashtagChirps(w, r)
+	})
 
 	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
 		apiCfg.handlerLogin(w, r)
@@ -140,12 +338,159 @@ func main() {
 	mux.HandleFunc("POST /api/revoke", func(w http.ResponseWriter, r *http.Request) {
 		apiCfg.handlerRevoke(w, r)
 	})
+	mux.HandleFunc("GET /api/users/me/mentions", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetMyMentions(w, r)
+	})
 	mux.HandleFunc("PUT /api/users", func(w http.ResponseWriter, r *http.Request) {
 		apiCfg.handlerUpdateUser(w, r)
 	})
 	mux.HandleFunc("DELETE /api/chirps/", func(w http.ResponseWriter, r *http.Request) {
 		apiCfg.handlerDeleteChirp(w, r)
 	})
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerUpdateChirp(w, r)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetChirpRevisions(w, r)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetChirpThread(w, r)
+	})
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerLikeChirp(w, r)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerUnlikeChirp(w, r)
+	})
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerRechirp(w, r)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerUndoRechirp(w, r)
+	})
+	mux.HandleFunc("GET /api/users/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetUserProfile(w, r)
+	})
+	mux.HandleFunc("POST /api/users/{userID}/follow", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerFollowUser(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerUnfollowUser(w, r)
+	})
+	mux.HandleFunc("GET /api/users/{userID}/followers", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetFollowers(w, r)
+	})
+	mux.HandleFunc("GET /api/users/{userID}/following", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetFollowing(w, r)
+	})
+	mux.HandleFunc("POST /api/users/{userID}/block", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerBlockUser(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/{userID}/block", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerUnblockUser(w, r)
+	})
+	mux.HandleFunc("POST /api/users/{userID}/mute", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerMuteUser(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerUnmuteUser(w, r)
+	})
+	mux.HandleFunc("GET /api/users/me/blocks", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetBlockedUsers(w, r)
+	})
+	mux.HandleFunc("GET /api/users/me/mutes", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetMutedUsers(w, r)
+	})
+	mux.HandleFunc("GET /api/timeline/home", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetHomeTimeline(w, r)
+	})
+	mux.HandleFunc("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerListSessions(w, r)
+	})
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerRevokeSession(w, r)
+	})
+	mux.HandleFunc("POST /api/sessions/revoke-all", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerRevokeAllSessions(w, r)
+	})
+	mux.HandleFunc("POST /api/users/verify", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerVerifyEmail(w, r)
+	})
+	mux.HandleFunc("POST /api/users/verify/resend", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerResendVerification(w, r)
+	})
+	mux.HandleFunc("POST /api/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerForgotPassword(w, r)
+	})
+	mux.HandleFunc("POST /api/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerResetPassword(w, r)
+	})
+	mux.HandleFunc("POST /api/login/mfa", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerLoginMFA(w, r)
+	})
+	mux.HandleFunc("GET /api/users/me/2fa", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetTwoFactorStatus(w, r)
+	})
+	mux.HandleFunc("POST /api/users/me/2fa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerEnrollTOTP(w, r)
+	})
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerConfirmTOTP(w, r)
+	})
+	mux.HandleFunc("POST /api/users/me/2fa/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerRegenerateRecoveryCodes(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/me/2fa", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerDisableTOTP(w, r)
+	})
+	mux.HandleFunc("POST /api/users/me/tokens", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerCreatePersonalAccessToken(w, r)
+	})
+	mux.HandleFunc("GET /api/users/me/tokens", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerListPersonalAccessTokens(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/me/tokens/{tokenID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerRevokePersonalAccessToken(w, r)
+	})
+	mux.HandleFunc("GET /oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerOAuthAuthorize(w, r)
+	})
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerOAuthToken(w, r)
+	})
+	mux.HandleFunc("POST /oauth/revoke", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerOAuthRevoke(w, r)
+	})
+	mux.HandleFunc("POST /api/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerOAuthConsent(w, r)
+	})
+	mux.HandleFunc("POST /api/oauth/clients", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerCreateOAuthClient(w, r)
+	})
+	mux.HandleFunc("GET /api/oauth/clients", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerListOAuthClients(w, r)
+	})
+	mux.HandleFunc("GET /api/oauth/clients/{clientID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetOAuthClient(w, r)
+	})
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerDeleteOAuthClient(w, r)
+	})
+	mux.HandleFunc("GET /api/oauth/consents", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerListOAuthConsents(w, r)
+	})
+	mux.HandleFunc("DELETE /api/oauth/consents/{clientID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerRevokeOAuthConsent(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/me", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerDeleteAccount(w, r)
+	})
+	mux.HandleFunc("GET /api/users/me/export", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerExportData(w, r)
+	})
+	mux.HandleFunc("GET /api/users/me/exports/{exportID}", func(w http.ResponseWriter, r *http.Request) {
+		apiCfg.handlerGetDataExport(w, r)
+	})
 	mux.HandleFunc("POST /api/polka/webhooks", func(w http.ResponseWriter, r *http.Request) {
 		apiCfg.handlerPolkaWebhooks(w, r)
 	})
@@ -159,6 +504,50 @@ func main() {
 	log.Fatal(srv.ListenAndServe())
 }
 
+// loadPasswordHasher builds the password hasher from PASSWORD_HASHER and
+// the ARGON2_* tuning variables. Hashes from the other scheme still verify
+// and are replaced as users log in.
+func loadPasswordHasher() (*auth.Passwords, error) {
+	params := auth.DefaultArgon2idParams
+	for _, setting := range []struct {
+		name  string
+		value *uint32
+	}{
+		{"ARGON2_MEMORY", &params.Memory},
+		{"ARGON2_ITERATIONS", &params.Iterations},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a positive integer", setting.name)
+			}
+			*setting.value = uint32(parsed)
+		}
+	}
+	if value := os.Getenv("ARGON2_PARALLELISM"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return nil, errors.New("ARGON2_PARALLELISM must be between 1 and 255")
+		}
+		params.Parallelism = uint8(parsed)
+	}
+
+	argon2idHasher, err := auth.NewArgon2idHasher(params)
+	if err != nil {
+		return nil, err
+	}
+	bcryptHasher := &auth.BcryptHasher{Cost: auth.DefaultBcryptCost}
+
+	switch os.Getenv("PASSWORD_HASHER") {
+	case "", "argon2id":
+		return auth.NewPasswords(argon2idHasher, bcryptHasher), nil
+	case "bcrypt":
+		return auth.NewPasswords(bcryptHasher, argon2idHasher), nil
+	default:
+		return nil, errors.New("PASSWORD_HASHER must be argon2id or bcrypt")
+	}
+}
+
 func handlerReadiness(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -186,6 +575,8 @@ func (cfg *apiConfig) handlerAdminMetrics(w http.ResponseWriter, r *http.Request
 	w.Write([]byte(html))
 }
 
+// handlerAdminReset deletes every user. Even admins may only do it in
+// development.
 func (cfg *apiConfig) handlerAdminReset(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
 		http.Error(w, "Forbidden", http.StatusForbidden)
@@ -217,7 +608,32 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(req.Password)
+	if err := validateEmail(req.Email); err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: "Invalid email address"}, http.StatusBadRequest)
+		return
+	}
+
+	var handle string
+	if req.Handle != "" {
+		handle, err = normalizeHandle(req.Handle)
+		if err != nil {
+			sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	} else {
+		handle, err = defaultHandle(req.Email)
+		if err != nil {
+			log.Printf("Error generating handle: %s", err)
+			sendJSONResponse(w, ErrorResponse{Error: "Failed to create user"}, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !cfg.checkPassword(w, req.Password, req.Email) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(req.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
 		sendJSONResponse(w, ErrorResponse{Error: "Failed to process password"}, http.StatusInternalServerError)
@@ -227,18 +643,28 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	userRes, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          req.Email,
 		HashedPassword: hashedPassword,
+		Handle:         handle,
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			sendJSONResponse(w, ErrorResponse{Error: "Email or handle already in use"}, http.StatusConflict)
+			return
+		}
 		log.Printf("Error creating user: %s", err)
 		sendJSONResponse(w, ErrorResponse{Error: "Failed to create user"}, http.StatusInternalServerError)
 		return
 	}
 
+	if err := cfg.sendVerificationEmail(r.Context(), userRes.ID, userRes.Email); err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
 	user := User{
 		ID:        userRes.ID,
 		CreatedAt: userRes.CreatedAt,
 		UpdateAt:  userRes.UpdatedAt,
 		Email:     userRes.Email,
+		Handle:    userRes.Handle,
 	}
 
 	sendJSONResponse(w, user, http.StatusCreated)
@@ -251,14 +677,11 @@ func handlerCreateChirp(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
-	userID, err := auth.ValidateJWT(tokenString, cfg.jwtSecret)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !cfg.requireVerifiedEmail(w, r, userID, restrictChirp) {
 		return
 	}
 
@@ -269,16 +692,74 @@ func handlerCreateChirp(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if len(req.Body) > 140 {
+	if len(req.Body) > maxChirpLength {
 		sendJSONResponse(w, ErrorResponse{Error: "Chirp is too long"}, http.StatusBadRequest)
 		return
 	}
 
 	cleanedBody := cleanChirpBody(req.Body)
 
-	dbChirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userID,
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	var inReplyTo uuid.NullUUID
+	if req.InReplyTo != nil {
+		parent, err := qtx.GetChirp(r.Context(), *req.InReplyTo)
+		if err == sql.ErrNoRows || (err == nil && parent.DeletedAt.Valid) {
+			sendJSONResponse(w, ErrorResponse{Error: "Chirp being replied to does not exist"}, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error retrieving parent chirp: %s", err)
+			sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+			return
+		}
+		if parent.RechirpOf.Valid {
+			sendJSONResponse(w, ErrorResponse{Error: "Reply to the original chirp instead of a rechirp"}, http.StatusBadRequest)
+			return
+		}
+		blocked, err := qtx.HasBlockBetween(r.Context(), database.HasBlockBetweenParams{
+			UserID:  userID,
+			OtherID: parent.UserID,
+		})
+		if err != nil {
+			log.Printf("Error checking blocks: %s", err)
+			sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			sendJSONResponse(w, ErrorResponse{Error: "Chirp being replied to does not exist"}, http.StatusBadRequest)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	var quoteOf uuid.NullUUID
+	if req.QuoteOf != nil {
+		quoted, err := cfg.resolveSharedChirp(r.Context(), qtx, userID, *req.QuoteOf)
+		if err == sql.ErrNoRows {
+			sendJSONResponse(w, ErrorResponse{Error: "Chirp being quoted does not exist"}, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error retrieving quoted chirp: %s", err)
+			sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	dbChirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:      cleanedBody,
+		UserID:    userID,
+		InReplyTo: inReplyTo,
+		QuoteOf:   quoteOf,
 	})
 	if err != nil {
 		log.Printf("Error creating chirp: %s", err)
@@ -286,12 +767,29 @@ func handlerCreateChirp(cfg *apiConfig, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	apiChirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+	if err := indexChirpHashtags(r.Context(), qtx, dbChirp); err != nil {
+		log.Printf("Error indexing chirp hashtags: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+		return
+	}
+
+	if err := indexChirpMentions(r.Context(), qtx, dbChirp); err != nil {
+		log.Printf("Error indexing chirp mentions: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing chirp: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+		return
+	}
+
+	apiChirp, err := cfg.loadChirp(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, dbChirp)
+	if err != nil {
+		log.Printf("Error loading chirp: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to create chirp"}, http.StatusInternalServerError)
+		return
 	}
 
 	sendJSONResponse(w, apiChirp, http.StatusCreated)
@@ -325,10 +823,19 @@ func sendJSONResponse(w http.ResponseWriter, response interface{}, statusCode in
 	w.Write(jsonData)
 }
 
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// value for a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 func respondWithError(w http.ResponseWriter, status int, message string, err error) {
 	response := map[string]string{
-		"error":   message,
-		"details": err.Error(),
+		"error": message,
+	}
+	if err != nil {
+		response["details"] = err.Error()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	minHandleLength = 3
+	maxHandleLength = 30
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// MentionEntity links an @handle inside a chirp body to the user it
+// resolved to when the chirp was written. Start and End are offsets in
+// Unicode code points, End being exclusive, and cover the '@'.
+type MentionEntity struct {
+	Handle string    `json:"handle"`
+	UserID uuid.UUID `json:"user_id"`
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+}
+
+// mentionToken is an @handle found in a chirp body, resolved or not.
+type mentionToken struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+func isHandleRune(r rune) bool {
+	return r == '_' || (r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+}
+
+// normalizeHandle lower-cases a handle and strips a leading '@', returning an
+// error when the result is not a valid handle.
+func normalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	if !handlePattern.MatchString(handle) {
+		return "", errors.New("handle must be 3-30 letters, digits or underscores")
+	}
+	return handle, nil
+}
+
+// defaultHandle derives a handle from the local part of email for clients
+// that don't choose one at signup. A random suffix keeps it unique.
+func defaultHandle(email string) (string, error) {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	local = strings.Map(func(r rune) rune {
+		if isHandleRune(r) {
+			return r
+		}
+		return '_'
+	}, local)
+	local = local[:min(len(local), maxHandleLength-9)]
+	if len(local) < minHandleLength {
+		local = "user"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return local + "_" + hex.EncodeToString(suffix), nil
+}
+
+// extractMentions finds every @handle in body. A mention must follow the
+// start of the body or a non-word character, so emails are not mentions.
+func extractMentions(body string) []mentionToken {
+	var tokens []mentionToken
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && (isHandleRune(runes[i-1]) || runes[i-1] == '@')) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isHandleRune(runes[end]) {
+			end++
+		}
+		length := end - i - 1
+		if length < minHandleLength || length > maxHandleLength {
+			continue
+		}
+
+		tokens = append(tokens, mentionToken{
+			Handle: strings.ToLower(string(runes[i+1 : end])),
+			Start:  i,
+			End:    end,
+		})
+		i = end - 1
+	}
+	return tokens
+}
+
+// indexChirpMentions resolves the @handles in chirp's body to users and
+// replaces its stored mentions. Handles that match nobody are ignored.
+// Run it in the same transaction that writes the chirp.
+func indexChirpMentions(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	if err := q.DeleteChirpMentions(ctx, chirp.ID); err != nil {
+		return err
+	}
+
+	var handles []string
+	for _, token := range extractMentions(chirp.Body) {
+		handles = append(handles, token.Handle)
+	}
+	if len(handles) == 0 {
+		return nil
+	}
+
+	users, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+
+	// Users in a block with the author are left unresolved so they are
+	// not notified and the chirp doesn't show up in their mentions.
+	blockedIDs, err := q.ListBlockRelatedUserIDs(ctx, chirp.UserID)
+	if err != nil {
+		return err
+	}
+	blocked := make(map[uuid.UUID]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+
+	for _, user := range users {
+		if blocked[user.ID] {
+			continue
+		}
+		err := q.AddChirpMention(ctx, database.AddChirpMentionParams{
+			ChirpID:   chirp.ID,
+			UserID:    user.ID,
+			Handle:    user.Handle,
+			CreatedAt: chirp.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mentionEntities pairs the @handles in body with the users they resolved
+// to, given the handle to user ID mapping stored for the chirp.
+func mentionEntities(body string, resolved map[string]uuid.UUID) []MentionEntity {
+	var entities []MentionEntity
+	for _, token := range extractMentions(body) {
+		userID, ok := resolved[token.Handle]
+		if !ok {
+			continue
+		}
+		entities = append(entities, MentionEntity{
+			Handle: token.Handle,
+			UserID: userID,
+			Start:  token.Start,
+			End:    token.End,
+		})
+	}
+	return entities
+}
+
+func (cfg *apiConfig) handlerGetMyMentions(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query(), sortDesc, sortAsc)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var dbChirps []database.Chirp
+	if page.descending() {
+		dbChirps, err = cfg.db.ListMentioningChirpsDesc(r.Context(), database.ListMentioningChirpsDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+	} else {
+		dbChirps, err = cfg.db.ListMentioningChirpsAsc(r.Context(), database.ListMentioningChirpsAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error retrieving mentions: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve mentions"}, http.StatusInternalServerError)
+		return
+	}
+
+	dbChirps, next, prev := paginate(page, dbChirps, databaseChirpCursor)
+
+	chirps, err := cfg.loadChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, dbChirps)
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve mentions"}, http.StatusInternalServerError)
+		return
+	}
+
+	setPaginationLinks(w, r, next, prev)
+	sendJSONResponse(w, chirps, http.StatusOK)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxOAuthClientName   = 100
+	maxOAuthRedirectURIs = 10
+)
+
+// OAuthClient is a registered third-party app. Confidential clients
+// authenticate to the token endpoint with their secret; public ones rely
+// on PKCE alone.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type createdOAuthClient struct {
+	OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func databaseOAuthClient(c database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Scopes:       c.Scopes,
+		Confidential: c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// validateRedirectURI accepts absolute https URIs, and http ones on the
+// loopback interface for apps running on the user's machine (RFC 8252).
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect URI %q is not an absolute URL", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not have a fragment", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI %q must use https", raw)
+}
+
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxOAuthClientName {
+		respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters", nil)
+		return
+	}
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxOAuthRedirectURIs {
+		respondWithError(w, http.StatusBadRequest, "Between 1 and 10 redirect URIs are required", nil)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid redirect URI", err)
+			return
+		}
+	}
+	if err := auth.ValidateScopes(params.Scopes); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid scopes", err)
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		var err error
+		secret, err = auth.MakeOpaqueToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't register client", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       params.Scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't register client", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, createdOAuthClient{
+		OAuthClient:  databaseOAuthClient(client),
+		ClientSecret: secret,
+	})
+}
+
+func (cfg *apiConfig) handlerListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListOAuthClients(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list clients", err)
+		return
+	}
+
+	clients := make([]OAuthClient, 0, len(rows))
+	for _, row := range rows {
+		clients = append(clients, databaseOAuthClient(row))
+	}
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// handlerGetOAuthClient describes a client to anyone, so the consent page
+// can show who is asking for access.
+func (cfg *apiConfig) handlerGetOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ID     uuid.UUID `json:"client_id"`
+		Name   string    `json:"name"`
+		Scopes []string  `json:"scopes"`
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Client not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve client", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ID:     client.ID,
+		Name:   client.Name,
+		Scopes: client.Scopes,
+	})
+}
+
+// handlerDeleteOAuthClient unregisters a client; every token issued to it
+// goes with it.
+func (cfg *apiConfig) handlerDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete client", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Client not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
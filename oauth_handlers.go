@@ -0,0 +1,672 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// oauthCodeDuration is the most RFC 6749 recommends for authorization
+	// codes.
+	oauthCodeDuration         = 10 * time.Minute
+	oauthAccessTokenDuration  = time.Hour
+	oauthRefreshTokenDuration = 30 * 24 * time.Hour
+	// consentPagePath is where the static consent page is served from,
+	// alongside index.html, and consentPageFile where it lives on disk.
+	consentPagePath = "/app/oauth/consent.html"
+	consentPageFile = "oauth/consent.html"
+)
+
+// authorizationRequest holds the parameters of an authorization code
+// request (RFC 6749 section 4.1.1) with its PKCE challenge (RFC 7636).
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func authorizationRequestFromQuery(query url.Values) authorizationRequest {
+	return authorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// oauthError is an error response as defined in RFC 6749 section 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func respondOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, status, oauthError{Code: code, Description: description})
+}
+
+// authorizationClient finds the client an authorization request is for and
+// checks its redirect URI. Problems here are reported to the user rather
+// than the redirect URI, which can't be trusted until it has been checked.
+func (cfg *apiConfig) authorizationClient(ctx context.Context, req authorizationRequest) (database.OauthClient, *oauthError, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, &oauthError{Code: "invalid_request", Description: "Unknown client_id"}, nil
+	}
+	client, err := cfg.db.GetOAuthClient(ctx, clientID)
+	if err == sql.ErrNoRows {
+		return database.OauthClient{}, &oauthError{Code: "invalid_request", Description: "Unknown client_id"}, nil
+	}
+	if err != nil {
+		return database.OauthClient{}, nil, err
+	}
+	if !slices.Contains(client.RedirectUris, req.RedirectURI) {
+		return database.OauthClient{}, &oauthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}, nil
+	}
+	return client, nil, nil
+}
+
+// authorizationScopes checks the rest of an authorization request for
+// client and returns the scopes it asks for.
+func authorizationScopes(client database.OauthClient, req authorizationRequest) ([]string, *oauthError) {
+	if req.ResponseType != "code" {
+		return nil, &oauthError{Code: "unsupported_response_type", Description: "Only the code response type is supported"}
+	}
+	if req.CodeChallengeMethod != auth.PKCEMethodS256 || !auth.ValidPKCEChallenge(req.CodeChallenge) {
+		return nil, &oauthError{Code: "invalid_request", Description: "A code_challenge using the S256 method is required"}
+	}
+	scopes, err := parseScopeParam(req.Scope, client.Scopes)
+	if err != nil {
+		return nil, &oauthError{Code: "invalid_scope", Description: err.Error()}
+	}
+	return scopes, nil
+}
+
+// parseScopeParam parses a space separated scope parameter, which may only
+// name scopes in allowed. An empty parameter asks for all of allowed.
+func parseScopeParam(scope string, allowed []string) ([]string, error) {
+	if strings.TrimSpace(scope) == "" {
+		return allowed, nil
+	}
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("scope %q is not allowed", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// authorizationRedirect returns the client's redirect URI with params and
+// the request's state added to its query.
+func authorizationRedirect(req authorizationRequest, params url.Values) string {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func authorizationErrorRedirect(req authorizationRequest, oerr *oauthError) string {
+	params := url.Values{"error": {oerr.Code}}
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	return authorizationRedirect(req, params)
+}
+
+// handlerOAuthAuthorize is where clients send users to ask for access. A
+// valid request is passed on to the consent page.
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizationRequestFromQuery(r.URL.Query())
+
+	client, oerr, err := cfg.authorizationClient(r.Context(), req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve client", err)
+		return
+	}
+	if oerr != nil {
+		respondOAuthError(w, http.StatusBadRequest, oerr.Code, oerr.Description)
+		return
+	}
+	if _, oerr := authorizationScopes(client, req); oerr != nil {
+		http.Redirect(w, r, authorizationErrorRedirect(req, oerr), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, consentPagePath+"?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// handlerOAuthConsentPage serves the consent page with headers that stop
+// other sites from framing it, where they could trick users into clicking
+// Allow.
+func (cfg *apiConfig) handlerOAuthConsentPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	http.ServeFile(w, r, consentPageFile)
+}
+
+// handlerOAuthConsent records the signed-in user's answer to an
+// authorization request and returns where to send them next: back to the
+// client with either an authorization code or an access_denied error.
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+		// EndSession signs out the session used to answer once it has.
+		EndSession bool `json:"end_session"`
+	}
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	userID, claims, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	// The consent page signs in only to answer, so it has that session
+	// ended rather than left behind unused.
+	if session := claims.Session(); params.EndSession && session.Valid {
+		defer func() {
+			_, err := cfg.db.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+				UserID:   userID,
+				FamilyID: session.UUID,
+			})
+			if err != nil {
+				log.Printf("Error ending consent session: %s", err)
+			}
+		}()
+	}
+	req := params.authorizationRequest
+
+	client, oerr, err := cfg.authorizationClient(r.Context(), req)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve client", err)
+		return
+	}
+	if oerr != nil {
+		respondOAuthError(w, http.StatusBadRequest, oerr.Code, oerr.Description)
+		return
+	}
+	scopes, oerr := authorizationScopes(client, req)
+	if oerr != nil {
+		respondWithJSON(w, http.StatusOK, response{RedirectTo: authorizationErrorRedirect(req, oerr)})
+		return
+	}
+	if !params.Approve {
+		respondWithJSON(w, http.StatusOK, response{RedirectTo: authorizationErrorRedirect(req, &oauthError{
+			Code:        "access_denied",
+			Description: "The user denied the request",
+		})})
+		return
+	}
+
+	err = cfg.db.UpsertOAuthConsent(r.Context(), database.UpsertOAuthConsentParams{
+		UserID:   userID,
+		ClientID: client.ID,
+		Scopes:   scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record consent", err)
+		return
+	}
+
+	code, err := auth.MakeOpaqueToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+	err = cfg.db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		FamilyID:      uuid.New(),
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeDuration),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RedirectTo: authorizationRedirect(req, url.Values{"code": {code}}),
+	})
+}
+
+// authenticateOAuthClient identifies the client calling the token or
+// revocation endpoint, from HTTP Basic credentials or the client_id and
+// client_secret form fields. Confidential clients must present their
+// secret. On failure it writes an invalid_client error and returns false.
+func (cfg *apiConfig) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	fail := func() (database.OauthClient, bool) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return database.OauthClient{}, false
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return fail()
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), clientID)
+	if err == sql.ErrNoRows {
+		return fail()
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve client", err)
+		return database.OauthClient{}, false
+	}
+	if client.SecretHash.Valid && subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return fail()
+	}
+	return client, true
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// issueOAuthTokens stores a new refresh token for client in familyID,
+// granting scopes, and returns it with an access token limited to
+// accessScopes.
+func (cfg *apiConfig) issueOAuthTokens(r *http.Request, q *database.Queries, client database.OauthClient, userID, familyID uuid.UUID, scopes, accessScopes []string) (oauthTokenResponse, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	_, err = q.CreateOAuthRefreshToken(r.Context(), database.CreateOAuthRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(oauthRefreshTokenDuration),
+		FamilyID:  familyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	accessToken, err := auth.MakeDelegatedJWT(userID, familyID, client.ID.String(), accessScopes, cfg.jwtKeys, oauthAccessTokenDuration)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	return oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenDuration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(accessScopes, " "),
+	}, nil
+}
+
+// checkGrantAccount makes sure the user behind a grant may still use their
+// account, answering invalid_grant when they are suspended or banned.
+func (cfg *apiConfig) checkGrantAccount(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	err := cfg.checkAccountStatus(r.Context(), userID)
+	if err == nil {
+		return true
+	}
+	var restriction *accountRestriction
+	if errors.As(err, &restriction) || errors.Is(err, auth.ErrTokenUnknown) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "The account that granted access can't be used")
+		return false
+	}
+	respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+	return false
+}
+
+func respondOAuthTokens(w http.ResponseWriter, tokens oauthTokenResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// handlerOAuthToken is the token endpoint of RFC 6749 section 3.2. It
+// takes form-encoded authorization_code and refresh_token grants.
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		cfg.refreshOAuthTokens(w, r, client)
+	case "":
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		respondOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code and refresh_token grants are supported")
+	}
+}
+
+// exchangeAuthorizationCode redeems an authorization code. A code that
+// comes back after being redeemed was intercepted, so the tokens issued
+// for it are revoked.
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	code, err := qtx.GetOAuthAuthorizationCodeForUpdate(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if err == sql.ErrNoRows {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+
+	if code.UsedAt.Valid {
+		revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), code.FamilyID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+			return
+		}
+		log.Printf("Authorization code reuse detected for client %s: revoked %d token(s) in family %s", client.ID, revoked, code.FamilyID)
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code has already been used")
+		return
+	}
+	if code.ClientID != client.ID || !code.ExpiresAt.After(time.Now().UTC()) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+	if code.RedirectUri != r.PostForm.Get("redirect_uri") {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+
+	if !cfg.checkGrantAccount(w, r, code.UserID) {
+		return
+	}
+
+	if err := qtx.MarkOAuthAuthorizationCodeUsed(r.Context(), code.CodeHash); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+	tokens, err := cfg.issueOAuthTokens(r, qtx, client, code.UserID, code.FamilyID, code.Scopes, code.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+
+	respondOAuthTokens(w, tokens)
+}
+
+// refreshOAuthTokens rotates a client's refresh token the way
+// handlerRefresh does for sessions. The access token may be narrowed to a
+// subset of the granted scopes.
+func (cfg *apiConfig) refreshOAuthTokens(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	stored, err := qtx.GetRefreshTokenForUpdate(r.Context(), r.PostForm.Get("refresh_token"))
+	if err == sql.ErrNoRows || (err == nil && stored.ClientID != (uuid.NullUUID{UUID: client.ID, Valid: true})) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+
+	if stored.RevokedAt.Valid {
+		revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), stored.FamilyID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+			return
+		}
+		log.Printf("Refresh token reuse detected for client %s: revoked %d token(s) in family %s", client.ID, revoked, stored.FamilyID)
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token has been revoked")
+		return
+	}
+	if !stored.ExpiresAt.After(time.Now().UTC()) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token has expired")
+		return
+	}
+
+	if !cfg.checkGrantAccount(w, r, stored.UserID) {
+		return
+	}
+
+	accessScopes, err := parseScopeParam(r.PostForm.Get("scope"), stored.Scopes)
+	if err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	if _, err := qtx.RevokeRefreshToken(r.Context(), stored.Token); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+	tokens, err := cfg.issueOAuthTokens(r, qtx, client, stored.UserID, stored.FamilyID, stored.Scopes, accessScopes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't issue tokens", err)
+		return
+	}
+
+	respondOAuthTokens(w, tokens)
+}
+
+// handlerOAuthRevoke is the revocation endpoint of RFC 7009. Revoking
+// either token of a grant ends the whole grant. Tokens that are unknown or
+// belong to another client are ignored, as the RFC requires.
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	client, ok := cfg.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := cfg.revokeOAuthToken(r.Context(), client, token); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) revokeOAuthToken(ctx context.Context, client database.OauthClient, token string) error {
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+
+	stored, err := cfg.db.GetRefreshTokenForUpdate(ctx, token)
+	if err == nil {
+		if stored.ClientID == clientID {
+			_, err = cfg.db.RevokeRefreshTokenFamily(ctx, stored.FamilyID)
+		}
+		return err
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	claims, err := auth.ParseJWT(token, cfg.jwtKeys)
+	if err != nil || claims.ClientID != client.ID.String() {
+		return nil
+	}
+	if session := claims.Session(); session.Valid {
+		_, err = cfg.db.RevokeRefreshTokenFamily(ctx, session.UUID)
+	}
+	return err
+}
+
+// OAuthConsent is an app the user has let act on their behalf.
+type OAuthConsent struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (cfg *apiConfig) handlerListOAuthConsents(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListOAuthConsents(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list authorized apps", err)
+		return
+	}
+
+	consents := make([]OAuthConsent, 0, len(rows))
+	for _, row := range rows {
+		consents = append(consents, OAuthConsent(row))
+	}
+	respondWithJSON(w, http.StatusOK, consents)
+}
+
+// handlerRevokeOAuthConsent withdraws an app's access and revokes every
+// token it holds for the caller.
+func (cfg *apiConfig) handlerRevokeOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	deleted, err := qtx.DeleteOAuthConsent(r.Context(), database.DeleteOAuthConsentParams{
+		UserID:   userID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "App not found", nil)
+		return
+	}
+
+	_, err = qtx.RevokeClientRefreshTokens(r.Context(), database.RevokeClientRefreshTokensParams{
+		UserID:   userID,
+		ClientID: uuid.NullUUID{UUID: clientID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke access", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor is the keyset position a page starts from. It is handed to
+// clients as an opaque base64 string, so its fields can change without
+// breaking anyone who treats it as a token.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	// Rank is only set for relevance-ordered search results.
+	Rank float32 `json:"r,omitempty"`
+	// Backward cursors fetch the page before the position instead of after it.
+	Backward bool `json:"b,omitempty"`
+}
+
+func (c pageCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+const (
+	sortAsc       = "asc"
+	sortDesc      = "desc"
+	sortRelevance = "relevance"
+)
+
+// pageRequest holds the parsed limit, sort and cursor query parameters
+// shared by every paginated chirp listing.
+type pageRequest struct {
+	Limit  int32
+	Sort   string
+	Cursor *pageCursor
+}
+
+// parsePageRequest reads limit, sort and cursor from query. sorts lists the
+// orderings the endpoint supports; the first one is used when sort is absent.
+func parsePageRequest(query url.Values, sorts ...string) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageLimit, Sort: sorts[0]}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = int32(min(limit, maxPageLimit))
+	}
+
+	if sortStr := strings.ToLower(query.Get("sort")); sortStr != "" {
+		if !slices.Contains(sorts, sortStr) {
+			return page, fmt.Errorf("sort must be one of: %s", strings.Join(sorts, ", "))
+		}
+		page.Sort = sortStr
+	}
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, err := decodePageCursor(cursorStr)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = &cursor
+	}
+
+	return page, nil
+}
+
+// descending reports which order the database should scan in. Paging
+// backward walks the opposite direction and reverses the result afterward.
+// Relevance is always ranked best first, so it scans descending too.
+func (p pageRequest) descending() bool {
+	desc := p.Sort != sortAsc
+	if p.Cursor != nil && p.Cursor.Backward {
+		return !desc
+	}
+	return desc
+}
+
+// fetchLimit asks for one extra row so we know whether another page exists.
+func (p pageRequest) fetchLimit() int32 {
+	return p.Limit + 1
+}
+
+func (p pageRequest) cursorParams() (sql.NullTime, uuid.NullUUID) {
+	if p.Cursor == nil {
+		return sql.NullTime{}, uuid.NullUUID{}
+	}
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true},
+		uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+func (p pageRequest) cursorRank() sql.NullFloat64 {
+	if p.Cursor == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(p.Cursor.Rank), Valid: true}
+}
+
+// paginate trims the extra row fetched by fetchLimit, restores the requested
+// order for backward pages and returns the cursors for neighbouring pages.
+// cursorFor returns the keyset position of an item.
+func paginate[T any](p pageRequest, items []T, cursorFor func(T) pageCursor) (page []T, next, prev *pageCursor) {
+	hasMore := len(items) > int(p.Limit)
+	if hasMore {
+		items = items[:p.Limit]
+	}
+
+	backward := p.Cursor != nil && p.Cursor.Backward
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	if len(items) == 0 {
+		return items, nil, nil
+	}
+
+	if hasMore || backward {
+		c := cursorFor(items[len(items)-1])
+		next = &c
+	}
+	if (backward && hasMore) || (!backward && p.Cursor != nil) {
+		c := cursorFor(items[0])
+		c.Backward = true
+		prev = &c
+	}
+
+	return items, next, prev
+}
+
+// setPaginationLinks advertises neighbouring pages through an RFC 8288 Link
+// header, keeping every other query parameter of the current request.
+func setPaginationLinks(w http.ResponseWriter, r *http.Request, next, prev *pageCursor) {
+	link := func(c *pageCursor, rel string) string {
+		query := r.URL.Query()
+		query.Set("cursor", c.encode())
+		u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	var links []string
+	if next != nil {
+		links = append(links, link(next, "next"))
+	}
+	if prev != nil {
+		links = append(links, link(prev, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/SethGK/chirpy/internal/auth"
+)
+
+// loadPasswordPolicy builds the password policy from PASSWORD_MIN_LENGTH,
+// PASSWORD_MAX_BYTES and BREACHED_PASSWORDS_FILE.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"PASSWORD_MIN_LENGTH", &policy.MinLength},
+		{"PASSWORD_MAX_BYTES", &policy.MaxBytes},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return auth.PasswordPolicy{}, fmt.Errorf("%s must be an integer", setting.name)
+			}
+			*setting.value = parsed
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return auth.PasswordPolicy{}, err
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := auth.OpenBreachedHashesFile(path)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("loading BREACHED_PASSWORDS_FILE: %w", err)
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+type passwordPolicyResponse struct {
+	Error      string                   `json:"error"`
+	Violations []auth.PasswordViolation `json:"violations"`
+}
+
+// checkPassword reports whether password is acceptable for the account
+// with the given email. When it is not it writes a 400 listing every
+// broken rule and returns false.
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password, email string) bool {
+	err := cfg.passwordPolicy.Check(password, email)
+	if err == nil {
+		return true
+	}
+
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		respondWithJSON(w, http.StatusBadRequest, passwordPolicyResponse{
+			Error:      "Password does not meet the password policy",
+			Violations: policyErr.Violations,
+		})
+		return false
+	}
+	log.Printf("Error checking password policy: %s", err)
+	respondWithError(w, http.StatusInternalServerError, "Couldn't check password", nil)
+	return false
+}
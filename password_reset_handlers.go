@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/SethGK/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTokenDuration = time.Hour
+	// maxPasswordResetsPerHour caps reset emails per account, so the
+	// endpoint can't be used to flood someone's inbox.
+	maxPasswordResetsPerHour = 3
+)
+
+// handlerForgotPassword always answers 202 without waiting for the lookup,
+// so neither the response nor its timing reveals whether an account exists
+// for the email.
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	if params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	go func(ctx context.Context) {
+		if err := cfg.sendPasswordResetEmail(ctx, params.Email); err != nil {
+			log.Printf("Error sending password reset email: %s", err)
+		}
+	}(context.WithoutCancel(r.Context()))
+
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for that email, a password reset link has been sent",
+	})
+}
+
+// sendPasswordResetEmail mails a reset token to the account registered
+// under email. Unknown emails and rate limited accounts are skipped
+// silently.
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, email string) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	recent, err := cfg.db.CountRecentPasswordResetTokens(ctx, database.CountRecentPasswordResetTokensParams{
+		UserID:    user.ID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	if recent >= maxPasswordResetsPerHour {
+		log.Printf("Skipping password reset for user %s: too many requests", user.ID)
+		return nil
+	}
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(passwordResetTokenDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"To choose a new password, send this token with it to POST /api/password/reset:\n\n"+
+			"    %s\n\n"+
+			"The token expires in %s and can only be used once. If you did not ask for a reset, "+
+			"you can ignore this email; your password has not changed.\n",
+			token, passwordResetTokenDuration),
+	})
+}
+
+// handlerResetPassword sets a new password using a token from
+// handlerForgotPassword, signs the account out everywhere and revokes its
+// personal access tokens.
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	if params.Token == "" || params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Token and password are required", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userID, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	// Rejecting the password rolls back the transaction, so the token can
+	// be used again with a better one.
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	if !cfg.checkPassword(w, params.Password, user.Email) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
+		return
+	}
+
+	err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	// Any other outstanding reset links die with this one.
+	if err := qtx.InvalidatePasswordResetTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := revokeUserAccess(r.Context(), qtx, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+)
+
+// fakeResetTokens stands in for password_reset_tokens, consuming tokens
+// the way ConsumePasswordResetToken does.
+type fakeResetTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*fakeResetToken
+}
+
+type fakeResetToken struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+// add stores a reset token for user, returning the token to send.
+func (f *fakeResetTokens) add(t *testing.T, user database.User, expiresAt time.Time) string {
+	t.Helper()
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("MakeOpaqueToken error: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens[auth.HashToken(token)] = &fakeResetToken{userID: user.ID.String(), expiresAt: expiresAt}
+	return token
+}
+
+func (f *fakeResetTokens) consume(args []driver.Value) [][]driver.Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hash, _ := args[0].(string)
+	token, ok := f.tokens[hash]
+	if !ok || token.used || !token.expiresAt.After(time.Now()) {
+		return nil
+	}
+	token.used = true
+	return [][]driver.Value{{token.userID}}
+}
+
+func newResetTest(t *testing.T) (*apiConfig, *fakeDB, database.User, *fakeResetTokens) {
+	t.Helper()
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	tokens := &fakeResetTokens{tokens: make(map[string]*fakeResetToken)}
+	db.handle("ConsumePasswordResetToken", tokens.consume)
+	return cfg, db, user, tokens
+}
+
+func resetPassword(cfg *apiConfig, token, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/password/reset",
+		strings.NewReader(`{"token":"`+token+`","password":"`+password+`"}`))
+	w := httptest.NewRecorder()
+	cfg.handlerResetPassword(w, req)
+	return w
+}
+
+func TestResetPassword(t *testing.T) {
+	cfg, db, user, tokens := newResetTest(t)
+	token := tokens.add(t, user, time.Now().Add(time.Hour))
+
+	w := resetPassword(cfg, token, "a much better password")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+
+	updated := db.argsOf("UpdateUserPassword")
+	if len(updated) != 1 {
+		t.Fatalf("UpdateUserPassword ran %d times, want 1", len(updated))
+	}
+	hash, _ := updated[0][0].(string)
+	if _, err := cfg.passwords.Verify("a much better password", hash); err != nil {
+		t.Errorf("stored hash doesn't match the new password: %v", err)
+	}
+	// revokeUserAccess signs out every session and revokes every token.
+	revoked := db.argsOf("RevokeOtherUserSessions")
+	if len(revoked) != 1 || revoked[0][0] != user.ID.String() || revoked[0][1] != nil {
+		t.Errorf("RevokeOtherUserSessions calls = %v, want one for every session of %s", revoked, user.ID)
+	}
+	if tokens := db.argsOf("RevokeUserPersonalAccessTokens"); len(tokens) != 1 || tokens[0][0] != user.ID.String() {
+		t.Errorf("RevokeUserPersonalAccessTokens calls = %v, want one for %s", tokens, user.ID)
+	}
+	for _, query := range []string{"InvalidatePasswordResetTokens", "COMMIT"} {
+		if !db.ran(query) {
+			t.Errorf("%s wasn't run", query)
+		}
+	}
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	cfg, db, user, tokens := newResetTest(t)
+	token := tokens.add(t, user, time.Now().Add(time.Hour))
+
+	if w := resetPassword(cfg, token, "a much better password"); w.Code != http.StatusNoContent {
+		t.Fatalf("first reset status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	w := resetPassword(cfg, token, "another new password")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("second reset status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+	if updated := db.argsOf("UpdateUserPassword"); len(updated) != 1 {
+		t.Errorf("UpdateUserPassword ran %d times, want 1", len(updated))
+	}
+}
+
+func TestResetPasswordExpiredToken(t *testing.T) {
+	cfg, db, user, tokens := newResetTest(t)
+	token := tokens.add(t, user, time.Now().Add(-time.Minute))
+
+	w := resetPassword(cfg, token, "a much better password")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+	for _, query := range []string{"UpdateUserPassword", "RevokeOtherUserSessions", "COMMIT"} {
+		if db.ran(query) {
+			t.Errorf("%s ran for an expired token", query)
+		}
+	}
+}
+
+func TestResetPasswordPolicyRollsBack(t *testing.T) {
+	cfg, db, user, tokens := newResetTest(t)
+	token := tokens.add(t, user, time.Now().Add(time.Hour))
+
+	w := resetPassword(cfg, token, "short")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), auth.RuleMinLength) {
+		t.Errorf("response doesn't name the broken rule: %s", w.Body)
+	}
+	// Rolling back keeps the token unused, so it can be tried again.
+	if !db.ran("ROLLBACK") {
+		t.Error("the consumed token wasn't rolled back")
+	}
+	for _, query := range []string{"UpdateUserPassword", "InvalidatePasswordResetTokens", "RevokeOtherUserSessions", "COMMIT"} {
+		if db.ran(query) {
+			t.Errorf("%s ran for a password the policy rejected", query)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPersonalAccessTokenName = 100
+	// maxPersonalAccessTokens caps the live tokens per user.
+	maxPersonalAccessTokens = 50
+)
+
+// PersonalAccessToken describes a token without the secret, which is only
+// returned once, when it is created.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type createdPersonalAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+func databasePersonalAccessToken(t database.PersonalAccessToken) PersonalAccessToken {
+	token := PersonalAccessToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		Prefix:    t.Prefix,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.ExpiresAt.Valid {
+		token.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		token.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return token
+}
+
+// handlerCreatePersonalAccessToken mints a named token limited to the
+// requested scopes, for bots and integrations that shouldn't hold the
+// user's password.
+func (cfg *apiConfig) handlerCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxPersonalAccessTokenName {
+		respondWithError(w, http.StatusBadRequest, "Name must be between 1 and 100 characters", nil)
+		return
+	}
+	if err := auth.ValidateScopes(params.Scopes); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid scopes", err)
+		return
+	}
+	var expiresAt sql.NullTime
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "Expiry must be in the future", nil)
+			return
+		}
+		expiresAt = sql.NullTime{Time: params.ExpiresAt.UTC(), Valid: true}
+	}
+
+	token, prefix, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.LockUserPersonalAccessTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+	count, err := qtx.CountPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+	if count >= maxPersonalAccessTokens {
+		respondWithError(w, http.StatusConflict, "Too many tokens; revoke one first", nil)
+		return
+	}
+
+	created, err := qtx.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      params.Name,
+		Prefix:    prefix,
+		TokenHash: auth.HashToken(token),
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, createdPersonalAccessToken{
+		PersonalAccessToken: databasePersonalAccessToken(created),
+		Token:               token,
+	})
+}
+
+func (cfg *apiConfig) handlerListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list tokens", err)
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(rows))
+	for _, row := range rows {
+		tokens = append(tokens, databasePersonalAccessToken(row))
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) handlerRevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
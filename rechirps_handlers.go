@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// resolveSharedChirp looks up the chirp to rechirp or quote. Sharing a plain
+// rechirp shares the chirp it points at, so embeds are never nested.
+// Deleted chirps, chirps by users in a block with userID and chirps whose
+// authors are hidden, as for hidden_chirp_authors, can't be shared and are
+// reported as sql.ErrNoRows.
+func (cfg *apiConfig) resolveSharedChirp(ctx context.Context, q *database.Queries, userID, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := q.GetChirp(ctx, chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	authors := []uuid.UUID{chirp.UserID}
+	if chirp.RechirpOf.Valid {
+		chirp, err = q.GetChirp(ctx, chirp.RechirpOf.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		authors = append(authors, chirp.UserID)
+	}
+	if chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	hidden, err := q.ListHiddenChirpAuthors(ctx, authors)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if len(hidden) > 0 {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	blocked, err := q.HasBlockBetween(ctx, database.HasBlockBetweenParams{
+		UserID:  userID,
+		OtherID: chirp.UserID,
+	})
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if blocked {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (cfg *apiConfig) handlerRechirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerifiedEmail(w, r, userID, restrictRechirp) {
+		return
+	}
+
+	original, err := cfg.resolveSharedChirp(r.Context(), cfg.db, userID, chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Chirp not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error retrieving chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	rechirp, err := cfg.db.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			sendJSONResponse(w, ErrorResponse{Error: "Chirp already rechirped"}, http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating rechirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	apiChirp, err := cfg.loadChirp(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, rechirp)
+	if err != nil {
+		log.Printf("Error loading chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, apiChirp, http.StatusCreated)
+}
+
+func (cfg *apiConfig) handlerUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error deleting rechirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "Rechirp not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"database/sql"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
 )
 
+// refreshTokenDuration is how long a refresh token stays valid. Every
+// refresh issues a new token, so an active session slides forward.
+const refreshTokenDuration = 24 * time.Hour
+
+// handlerRefresh exchanges a refresh token for a new access token and a new
+// refresh token in the same family, revoking the one presented. A revoked
+// token coming back means it was copied, so the whole family is revoked.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,15 +29,89 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	stored, err := qtx.GetRefreshTokenForUpdate(r.Context(), refreshToken)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+	// Tokens issued to OAuth clients are refreshed at /oauth/token, which
+	// keeps their scopes.
+	if stored.ClientID.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", nil)
+		return
+	}
+
+	if stored.RevokedAt.Valid {
+		revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), stored.FamilyID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+			return
+		}
+		log.Printf("Refresh token reuse detected for user %s: revoked %d token(s) in family %s", stored.UserID, revoked, stored.FamilyID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has been revoked", nil)
+		return
+	}
+	if !stored.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has expired", nil)
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), stored.UserID)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
 		return
 	}
+	if restriction := restrictionOf(user.Status, user.StatusReason, user.SuspendedUntil, time.Now().UTC()); restriction != nil {
+		respondAccountRestricted(w, restriction)
+		return
+	}
+
+	_, err = qtx.RevokeRefreshToken(r.Context(), stored.Token)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
 
-	accessToken, err := auth.MakeJWT(
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     newRefreshToken,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenDuration),
+		FamilyID:  stored.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
+		return
+	}
+
+	accessToken, err := auth.MakeSessionJWT(
 		user.ID,
-		cfg.jwtSecret,
+		stored.FamilyID,
+		user.Role,
+		cfg.jwtKeys,
 		time.Hour,
 	)
 	if err != nil {
@@ -34,5 +119,13 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sendJSONResponse(w, response{Token: accessToken}, http.StatusOK)
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh session", err)
+		return
+	}
+
+	sendJSONResponse(w, response{
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
+	}, http.StatusOK)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// refreshTokenRow is a refresh_tokens row for token, issued to user in
+// family. revokedAt and clientID are nil unless the token was revoked or
+// issued to an OAuth client.
+func refreshTokenRow(token string, user database.User, family uuid.UUID, revokedAt, clientID driver.Value) []driver.Value {
+	now := time.Now().UTC()
+	return []driver.Value{
+		token, now, now, user.ID.String(), now.Add(time.Hour), revokedAt,
+		family.String(), "", "", now, clientID, nil,
+	}
+}
+
+func refresh(cfg *apiConfig, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	cfg.handlerRefresh(w, req)
+	return w
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	family := uuid.New()
+	db.setRows("GetRefreshTokenForUpdate", refreshTokenRow("first", user, family, nil, nil))
+	db.setRows("RevokeRefreshToken", refreshTokenRow("first", user, family, time.Now().UTC(), nil))
+	db.setRows("CreateRefreshToken", refreshTokenRow("second", user, family, nil, nil))
+
+	w := refresh(cfg, "first")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.RefreshToken == "first" {
+		t.Errorf("response = %+v, want a new access and refresh token", resp)
+	}
+
+	if revoked := db.argsOf("RevokeRefreshToken"); len(revoked) != 1 || revoked[0][0] != "first" {
+		t.Errorf("RevokeRefreshToken calls = %v, want one for the presented token", revoked)
+	}
+	created := db.argsOf("CreateRefreshToken")
+	if len(created) != 1 {
+		t.Fatalf("CreateRefreshToken ran %d times, want 1", len(created))
+	}
+	// Token, user, expiry, then the family the new token joins.
+	if created[0][0] != resp.RefreshToken || created[0][3] != family.String() {
+		t.Errorf("CreateRefreshToken args = %v, want the returned token in family %s", created[0], family)
+	}
+	if !db.ran("COMMIT") {
+		t.Error("rotation wasn't committed")
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	family := uuid.New()
+	db.setRows("GetRefreshTokenForUpdate", refreshTokenRow("first", user, family, nil, nil))
+	db.setRows("RevokeRefreshToken", refreshTokenRow("first", user, family, time.Now().UTC(), nil))
+	db.setRows("CreateRefreshToken", refreshTokenRow("second", user, family, nil, nil))
+	if w := refresh(cfg, "first"); w.Code != http.StatusOK {
+		t.Fatalf("first refresh status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	// The rotated token comes back, as it would if it had been copied.
+	db.setRows("GetRefreshTokenForUpdate", refreshTokenRow("first", user, family, time.Now().UTC(), nil))
+	w := refresh(cfg, "first")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("reuse status = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+	revoked := db.argsOf("RevokeRefreshTokenFamily")
+	if len(revoked) != 1 || revoked[0][0] != family.String() {
+		t.Errorf("RevokeRefreshTokenFamily calls = %v, want one for family %s", revoked, family)
+	}
+	if created := db.argsOf("CreateRefreshToken"); len(created) != 1 {
+		t.Errorf("CreateRefreshToken ran %d times, want only the first rotation", len(created))
+	}
+	// The family's revocation must stick even though the request fails.
+	if commits := len(db.argsOf("COMMIT")); commits != 2 {
+		t.Errorf("commits = %d, want 2", commits)
+	}
+}
+
+func TestRefreshRejectsOAuthClientTokens(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	db.setRows("GetRefreshTokenForUpdate", refreshTokenRow("delegated", user, uuid.New(), nil, uuid.NewString()))
+
+	w := refresh(cfg, "delegated")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+	for _, query := range []string{"RevokeRefreshToken", "RevokeRefreshTokenFamily", "CreateRefreshToken", "COMMIT"} {
+		if db.ran(query) {
+			t.Errorf("%s ran for an OAuth client's token", query)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Session is a signed-in device: a refresh token family together with the
+// metadata recorded the last time it was used.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+}
+
+// clientIP returns the address the request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) handlerListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, claims, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	current := claims.Session()
+
+	rows, err := cfg.db.ListUserSessions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list sessions", err)
+		return
+	}
+
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:         row.FamilyID,
+			StartedAt:  row.StartedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			UserAgent:  row.UserAgent,
+			IPAddress:  row.IpAddress,
+			Current:    current.Valid && current.UUID == row.FamilyID,
+		})
+	}
+	sendJSONResponse(w, sessions, http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := cfg.db.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerRevokeAllSessions signs the caller out everywhere except the
+// session their access token belongs to.
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, claims, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.db.RevokeOtherUserSessions(r.Context(), database.RevokeOtherUserSessionsParams{
+		UserID:       userID,
+		KeepFamilyID: claims.Session(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+)
+
+const (
+	defaultKeyRotationInterval = 30 * 24 * time.Hour
+	// keyVerificationGrace keeps a key verifying after it stops signing, so
+	// tokens issued just before a rotation outlive it.
+	keyVerificationGrace = 24 * time.Hour
+	// keyRefreshInterval is how often keys are reloaded from the database
+	// and rotated when due, which also picks up keys other instances made.
+	keyRefreshInterval = time.Minute
+	// jwksMaxAge is how long clients may cache the published key set.
+	jwksMaxAge = 5 * time.Minute
+	// keyActivationDelay is how long a new key is published before it
+	// signs, so that other instances and verifiers caching the key set
+	// have it by the time tokens signed with it turn up.
+	keyActivationDelay = keyRefreshInterval + jwksMaxAge
+)
+
+// loadSigningKeys replaces the keyring with the unexpired keys stored in
+// the database.
+func (cfg *apiConfig) loadSigningKeys(ctx context.Context) error {
+	rows, err := cfg.db.ListActiveSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]auth.SigningKey, 0, len(rows))
+	for _, row := range rows {
+		privateKey, err := auth.OpenPrivateKey(row.PrivateKey, cfg.jwtSecret)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %s", row.Kid, err)
+			continue
+		}
+		keys = append(keys, auth.SigningKey{
+			ID:         row.Kid,
+			Algorithm:  row.Algorithm,
+			PrivateKey: privateKey,
+			CreatedAt:  row.CreatedAt,
+			ActiveAt:   row.ActivatesAt,
+			ExpiresAt:  row.ExpiresAt,
+		})
+	}
+	cfg.jwtKeys.Replace(keys)
+	return nil
+}
+
+// rotateSigningKeys generates a new signing key once the latest one is
+// older than the rotation interval, or when there is none at all. The new
+// key only signs after keyActivationDelay, unless nothing else can sign.
+// Instances rotate one at a time and check again under the lock, so only
+// one of them creates the key.
+func (cfg *apiConfig) rotateSigningKeys(ctx context.Context) error {
+	now := time.Now().UTC()
+	if latest, ok := cfg.jwtKeys.Latest(); ok && !cfg.signingKeyDue(latest.Algorithm, latest.CreatedAt, now) {
+		return nil
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.LockSigningKeyRotation(ctx); err != nil {
+		return err
+	}
+	latest, err := qtx.GetLatestSigningKey(ctx)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && !cfg.signingKeyDue(latest.Algorithm, latest.CreatedAt, now) {
+		// Another instance got there first.
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return cfg.loadSigningKeys(ctx)
+	}
+
+	activeAt := now.Add(keyActivationDelay)
+	if _, ok := cfg.jwtKeys.Newest(); !ok {
+		activeAt = now
+	}
+	key, err := auth.GenerateSigningKey(cfg.jwtAlgorithm, now, activeAt.Sub(now)+cfg.jwtKeyRotation+keyVerificationGrace)
+	if err != nil {
+		return err
+	}
+	sealed, err := auth.SealPrivateKey(key.PrivateKey, cfg.jwtSecret)
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.CreateSigningKey(ctx, database.CreateSigningKeyParams{
+		Kid:         key.ID,
+		Algorithm:   key.Algorithm,
+		PrivateKey:  sealed,
+		CreatedAt:   key.CreatedAt,
+		ExpiresAt:   key.ExpiresAt,
+		ActivatesAt: activeAt,
+	})
+	if err != nil {
+		return err
+	}
+	if err := qtx.DeleteExpiredSigningKeys(ctx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Rotated JWT signing key: new %s key %s signs from %s", key.Algorithm, key.ID, activeAt.Format(time.RFC3339))
+
+	return cfg.loadSigningKeys(ctx)
+}
+
+// signingKeyDue reports whether a key for algorithm created at createdAt
+// is due to be replaced at now.
+func (cfg *apiConfig) signingKeyDue(algorithm string, createdAt, now time.Time) bool {
+	return algorithm != cfg.jwtAlgorithm || !now.Before(createdAt.Add(cfg.jwtKeyRotation))
+}
+
+// runKeyRotation keeps the keyring in sync with the database and rotates
+// keys on schedule until ctx is done.
+func (cfg *apiConfig) runKeyRotation(ctx context.Context) {
+	ticker := time.NewTicker(keyRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.loadSigningKeys(ctx); err != nil {
+				log.Printf("Error loading signing keys: %s", err)
+				continue
+			}
+			if err := cfg.rotateSigningKeys(ctx); err != nil {
+				log.Printf("Error rotating signing keys: %s", err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	sendJSONResponse(w, cfg.jwtKeys.JWKS(), http.StatusOK)
+}
@@ -0,0 +1,63 @@
+-- name: ListUsersForAdminAsc :many
+SELECT * FROM users
+WHERE (
+    sqlc.narg('search')::text IS NULL
+    OR email ILIKE '%' || sqlc.narg('search') || '%'
+    OR handle ILIKE '%' || sqlc.narg('search') || '%'
+)
+AND (sqlc.narg('role')::text IS NULL OR role = sqlc.narg('role'))
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListUsersForAdminDesc :many
+SELECT * FROM users
+WHERE (
+    sqlc.narg('search')::text IS NULL
+    OR email ILIKE '%' || sqlc.narg('search') || '%'
+    OR handle ILIKE '%' || sqlc.narg('search') || '%'
+)
+AND (sqlc.narg('role')::text IS NULL OR role = sqlc.narg('role'))
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: PromoteUserToAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE email = $1
+AND role <> 'admin';
+
+-- name: SetUserStatus :one
+UPDATE users
+SET
+    status = $2,
+    status_reason = $3,
+    suspended_until = $4,
+    chirps_hidden = $5,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateAccountStatusEvent :exec
+INSERT INTO account_status_events (id, user_id, actor_id, status, reason, suspended_until, chirps_hidden, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW());
+
+-- name: ListAccountStatusEvents :many
+SELECT account_status_events.*, actors.handle AS actor_handle
+FROM account_status_events
+LEFT JOIN users actors ON actors.id = account_status_events.actor_id
+WHERE account_status_events.user_id = $1
+ORDER BY account_status_events.created_at DESC;
@@ -1,6 +1,6 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip_address, last_used_at)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, NOW())
 RETURNING *;
 
 -- name: RevokeRefreshToken :one
@@ -9,6 +9,17 @@ SET revoked_at = NOW(), updated_at = NOW()
 WHERE token = $1
 RETURNING *;
 
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens
+WHERE token = $1
+FOR UPDATE;
+
 -- name: GetUserFromRefreshToken :one
 SELECT users.* FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
@@ -17,8 +28,47 @@ AND refresh_tokens.revoked_at IS NULL
 AND refresh_tokens.expires_at > NOW();
 
 -- name: InsertRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
-VALUES ($1, NOW(), NOW(), $2, $3)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, family_id, user_agent, ip_address, last_used_at)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, NOW())
 RETURNING *;
 
+-- name: ListUserSessions :many
+SELECT
+    refresh_tokens.family_id,
+    refresh_tokens.user_agent,
+    refresh_tokens.ip_address,
+    refresh_tokens.last_used_at,
+    refresh_tokens.expires_at,
+    (
+        SELECT MIN(family.created_at)
+        FROM refresh_tokens family
+        WHERE family.family_id = refresh_tokens.family_id
+    )::timestamp AS started_at
+FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
+AND refresh_tokens.revoked_at IS NULL
+AND refresh_tokens.expires_at > NOW()
+AND refresh_tokens.client_id IS NULL
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1
+AND family_id = $2
+AND revoked_at IS NULL;
+
+-- name: RevokeOtherUserSessions :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = sqlc.arg('user_id')
+AND revoked_at IS NULL
+AND (sqlc.narg('keep_family_id')::uuid IS NULL OR family_id <> sqlc.narg('keep_family_id'));
 
+-- name: IsRefreshTokenFamilyActive :one
+SELECT EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE family_id = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+);
@@ -0,0 +1,43 @@
+-- name: BlockUser :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: HasBlockBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg('user_id') AND blocked_id = sqlc.arg('other_id'))
+    OR (blocker_id = sqlc.arg('other_id') AND blocked_id = sqlc.arg('user_id'))
+);
+
+-- name: ListBlockRelatedUserIDs :many
+SELECT blocked_id FROM blocks WHERE blocker_id = sqlc.arg('user_id')
+UNION
+SELECT blocker_id FROM blocks WHERE blocked_id = sqlc.arg('user_id');
+
+-- name: ListBlockedUsers :many
+SELECT users.id, users.handle, blocks.created_at AS blocked_at
+FROM blocks
+JOIN users ON users.id = blocks.blocked_id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC, users.id DESC;
+
+-- name: MuteUser :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :exec
+DELETE FROM mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: ListMutedUsers :many
+SELECT users.id, users.handle, mutes.created_at AS muted_at
+FROM mutes
+JOIN users ON users.id = mutes.muted_id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC, users.id DESC;
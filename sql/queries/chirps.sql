@@ -1,20 +1,270 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
 RETURNING *;
 
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of = $1;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
--- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: ChirpHasReplies :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps WHERE in_reply_to = $1
+);
+
+-- name: ChirpHasQuotes :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps WHERE quote_of = $1
+);
+
+-- name: GetChirpsByIDs :many
+SELECT *
 FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
\ No newline at end of file
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: ListHiddenChirpAuthors :many
+SELECT id
+FROM hidden_chirp_authors
+WHERE id = ANY(sqlc.arg('user_ids')::uuid[]);
+
+-- name: GetChirpForUpdate :one
+SELECT *
+FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.arg('include_rechirps')::boolean OR rechirp_of IS NULL)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.arg('include_rechirps')::boolean OR rechirp_of IS NULL)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsAsc :many
+SELECT sqlc.embed(chirps), ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', sqlc.arg('query'))
+AND deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsDesc :many
+SELECT sqlc.embed(chirps), ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', sqlc.arg('query'))
+AND deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsByRank :many
+SELECT sqlc.embed(chirps), ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', sqlc.arg('query'))
+AND deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+AND (
+    sqlc.narg('cursor_rank')::real IS NULL
+    OR (ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')))::real, created_at, id)
+        < (sqlc.narg('cursor_rank'), sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirpsByRankReverse :many
+SELECT sqlc.embed(chirps), ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')))::real AS rank
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', sqlc.arg('query'))
+AND deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+AND (
+    sqlc.narg('cursor_rank')::real IS NULL
+    OR (ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')))::real, created_at, id)
+        > (sqlc.narg('cursor_rank'), sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY rank ASC, created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.*, 1 AS depth
+    FROM chirps
+    WHERE chirps.id = (SELECT c.in_reply_to FROM chirps c WHERE c.id = sqlc.arg('chirp_id'))
+    UNION ALL
+    SELECT chirps.*, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to
+    WHERE ancestors.depth < sqlc.arg('max_depth')::int
+)
+SELECT *
+FROM ancestors
+ORDER BY depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.*, 1 AS depth
+    FROM chirps
+    WHERE chirps.in_reply_to = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT chirps.*, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+    WHERE descendants.depth < sqlc.arg('max_depth')::int
+)
+SELECT *
+FROM descendants
+ORDER BY depth ASC, created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
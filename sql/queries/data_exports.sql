@@ -0,0 +1,73 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at, expires_at)
+VALUES (gen_random_uuid(), $1, 'pending', NOW(), $2)
+RETURNING id, user_id, status, created_at, completed_at, expires_at;
+
+-- name: LockUserDataExports :exec
+-- Taken before looking for a user's latest export, so that parallel requests
+-- can't both start one. NO KEY UPDATE leaves rows referencing the user alone.
+SELECT id FROM users
+WHERE id = $1
+FOR NO KEY UPDATE;
+
+-- name: GetLatestDataExport :one
+SELECT id, user_id, status, created_at, completed_at, expires_at
+FROM data_exports
+WHERE user_id = $1
+AND expires_at > NOW()
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExport :one
+SELECT *
+FROM data_exports
+WHERE id = $1
+AND user_id = $2
+AND expires_at > NOW();
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', archive = $2, completed_at = NOW()
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at <= NOW();
+
+-- name: CountUserChirps :one
+SELECT COUNT(*)
+FROM chirps
+WHERE user_id = $1
+AND deleted_at IS NULL;
+
+-- name: ListUserChirpsForExport :many
+SELECT *
+FROM chirps
+WHERE user_id = $1
+AND deleted_at IS NULL
+ORDER BY created_at ASC, id ASC;
+
+-- name: ListUserLikesForExport :many
+SELECT chirp_id, created_at
+FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at ASC, chirp_id ASC;
+
+-- name: ListFollowingForExport :many
+SELECT users.id, users.handle, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = $1
+ORDER BY follows.created_at ASC, users.id ASC;
+
+-- name: ListFollowersForExport :many
+SELECT users.id, users.handle, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1
+ORDER BY follows.created_at ASC, users.id ASC;
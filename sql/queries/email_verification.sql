@@ -0,0 +1,21 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4);
+
+-- name: GetEmailVerificationToken :one
+SELECT * FROM email_verification_tokens
+WHERE token_hash = $1
+AND expires_at > NOW();
+
+-- name: DeleteEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens
+WHERE user_id = $1;
+
+-- name: GetEmailVerificationStats :one
+SELECT
+    COUNT(*) AS sent,
+    COALESCE(MIN(created_at), 'epoch')::timestamp AS first_sent_at,
+    COALESCE(MAX(created_at), 'epoch')::timestamp AS last_sent_at
+FROM email_verification_tokens
+WHERE user_id = $1
+AND created_at > $2;
@@ -0,0 +1,90 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowCounts :one
+SELECT
+    (
+        SELECT COUNT(*) FROM follows
+        WHERE followee_id = sqlc.arg('user_id')::uuid
+        AND NOT EXISTS (SELECT 1 FROM hidden_chirp_authors WHERE hidden_chirp_authors.id = follows.follower_id)
+    ) AS followers,
+    (
+        SELECT COUNT(*) FROM follows
+        WHERE follower_id = sqlc.arg('user_id')::uuid
+        AND NOT EXISTS (SELECT 1 FROM hidden_chirp_authors WHERE hidden_chirp_authors.id = follows.followee_id)
+    ) AS following;
+
+-- name: ListFollowersAsc :many
+SELECT users.id, users.handle, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = sqlc.arg('user_id')
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = users.id
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, follows.follower_id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY follows.created_at ASC, follows.follower_id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowersDesc :many
+SELECT users.id, users.handle, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = sqlc.arg('user_id')
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = users.id
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, follows.follower_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY follows.created_at DESC, follows.follower_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowingAsc :many
+SELECT users.id, users.handle, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = users.id
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, follows.followee_id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY follows.created_at ASC, follows.followee_id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowingDesc :many
+SELECT users.id, users.handle, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = users.id
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, follows.followee_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY follows.created_at DESC, follows.followee_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: DeleteFollowsBetween :exec
+DELETE FROM follows
+WHERE (follower_id = sqlc.arg('user_id') AND followee_id = sqlc.arg('other_id'))
+OR (follower_id = sqlc.arg('other_id') AND followee_id = sqlc.arg('user_id'));
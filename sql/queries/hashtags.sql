@@ -0,0 +1,83 @@
+-- name: UpsertHashtag :one
+INSERT INTO hashtags (id, tag, created_at)
+VALUES (gen_random_uuid(), $1, NOW())
+ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+RETURNING *;
+
+-- name: AddChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: ListChirpsByHashtagAsc :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_hashtags.created_at, chirp_hashtags.chirp_id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY chirp_hashtags.created_at ASC, chirp_hashtags.chirp_id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsByHashtagDesc :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_hashtags.created_at, chirp_hashtags.chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id')::uuid)
+    OR (blocks.blocker_id = sqlc.narg('viewer_id')::uuid AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.narg('viewer_id')::uuid AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY chirp_hashtags.created_at DESC, chirp_hashtags.chirp_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetTrendingHashtags :many
+SELECT
+    hashtags.tag,
+    COUNT(*) AS uses,
+    COUNT(DISTINCT chirps.user_id) AS authors
+FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirp_hashtags.created_at >= sqlc.arg('since')
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+GROUP BY hashtags.tag
+ORDER BY authors DESC, uses DESC, hashtags.tag ASC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,37 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE key = $1;
+
+-- name: EnsureLoginThrottle :exec
+INSERT INTO login_throttles (key)
+VALUES ($1)
+ON CONFLICT (key) DO NOTHING;
+
+-- name: GetLoginThrottleForUpdate :one
+SELECT * FROM login_throttles
+WHERE key = $1
+FOR UPDATE;
+
+-- name: UpdateLoginThrottle :exec
+UPDATE login_throttles
+SET failures = $2, last_failure_at = $3, locked_until = $4
+WHERE key = $1;
+
+-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
+
+-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE starts_with(key, sqlc.arg('prefix')::text)
+AND (last_failure_at IS NULL OR last_failure_at <= sqlc.arg('stale_before')::timestamp)
+AND (locked_until IS NULL OR locked_until <= sqlc.arg('now')::timestamp);
+
+-- name: CreateLoginLockout :exec
+INSERT INTO login_lockouts (scope, subject, failures, locked_at, locked_until)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListLoginLockouts :many
+SELECT * FROM login_lockouts
+ORDER BY locked_at DESC
+LIMIT $1;
@@ -0,0 +1,63 @@
+-- name: AddChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, handle, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetMentionsForChirps :many
+SELECT *
+FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: ListMentioningChirpsAsc :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_mentions.created_at, chirp_mentions.chirp_id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg('user_id'))
+    OR (blocks.blocker_id = sqlc.arg('user_id') AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg('user_id') AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY chirp_mentions.created_at ASC, chirp_mentions.chirp_id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListMentioningChirpsDesc :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_mentions.created_at, chirp_mentions.chirp_id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg('user_id'))
+    OR (blocks.blocker_id = sqlc.arg('user_id') AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg('user_id') AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY chirp_mentions.created_at DESC, chirp_mentions.chirp_id DESC
+LIMIT sqlc.arg('limit');
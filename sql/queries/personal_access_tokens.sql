@@ -0,0 +1,47 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, user_id, name, prefix, token_hash, scopes, created_at, expires_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), $6)
+RETURNING *;
+
+-- name: LockUserPersonalAccessTokens :exec
+-- Taken before counting a user's tokens, so that parallel requests can't
+-- both pass the cap. NO KEY UPDATE leaves rows referencing the user alone.
+SELECT id FROM users
+WHERE id = $1
+FOR NO KEY UPDATE;
+
+-- name: CountPersonalAccessTokens :one
+SELECT COUNT(*) FROM personal_access_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE id = $1
+AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: ListPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1
+AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: RevokeUserPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
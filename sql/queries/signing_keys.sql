@@ -0,0 +1,24 @@
+-- name: CreateSigningKey :one
+INSERT INTO signing_keys (kid, algorithm, private_key, created_at, expires_at, activates_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: LockSigningKeyRotation :exec
+-- Held while deciding whether to create a key, so instances rotating at
+-- the same time create one between them.
+SELECT pg_advisory_xact_lock(hashtext('signing_key_rotation'));
+
+-- name: GetLatestSigningKey :one
+SELECT * FROM signing_keys
+WHERE expires_at > NOW()
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: ListActiveSigningKeys :many
+SELECT * FROM signing_keys
+WHERE expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: DeleteExpiredSigningKeys :exec
+DELETE FROM signing_keys
+WHERE expires_at <= NOW();
@@ -0,0 +1,55 @@
+-- name: ListHomeTimelineAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (
+    user_id = sqlc.arg('user_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id'))
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg('user_id'))
+    OR (blocks.blocker_id = sqlc.arg('user_id') AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg('user_id') AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListHomeTimelineDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (
+    user_id = sqlc.arg('user_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id'))
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.arg('user_id'))
+    OR (blocks.blocker_id = sqlc.arg('user_id') AND blocks.blocked_id = chirps.user_id)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = sqlc.arg('user_id') AND mutes.muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM hidden_chirp_authors
+    WHERE hidden_chirp_authors.id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
@@ -1,45 +1,82 @@
 -- name: CreateUser :one
-INSERT INTO users(id, created_at, updated_at, email, hashed_password)
+INSERT INTO users(id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password;
+RETURNING id, created_at, updated_at, email, hashed_password, handle;
 
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
 
--- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id
-FROM chirps
-ORDER BY created_at ASC;
+-- name: ScheduleUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1
+AND deletion_scheduled_at IS NOT NULL;
+
+-- name: DeleteUsersScheduledBefore :execrows
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1;
 
 -- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT *
 FROM chirps
 WHERE id = $1;
 
 -- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT *
 FROM users
 WHERE email = $1;
 
+-- name: GetUserAccountStatus :one
+SELECT status, status_reason, suspended_until, deletion_scheduled_at
+FROM users
+WHERE id = $1;
+
 -- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT *
 FROM users
 WHERE id = $1;
 
+-- name: GetUsersByHandles :many
+SELECT id, handle
+FROM users
+WHERE handle = ANY(sqlc.arg('handles')::text[]);
+
+-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = now()
-WHERE id = $3
-RETURNING id, email, created_at, updated_at;
+SET
+    email = $1,
+    hashed_password = $2,
+    handle = $3,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+    updated_at = now()
+WHERE id = $4
+RETURNING id, email, handle, created_at, updated_at, email_verified_at;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
 
 -- name: UpgradeUsertoChirpyRed :one
 UPDATE users
 SET is_chirpy_red = true, updated_at = now()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red;
\ No newline at end of file
+RETURNING *;
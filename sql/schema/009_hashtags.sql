@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE hashtags (
+    id UUID PRIMARY KEY,
+    tag TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- created_at mirrors the chirp's creation time so tag timelines and
+-- trending windows can be served from this table's index alone.
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    hashtag_id UUID NOT NULL REFERENCES hashtags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, hashtag_id)
+);
+
+CREATE INDEX chirp_hashtags_hashtag_id_created_at_idx ON chirp_hashtags (hashtag_id, created_at, chirp_id);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags (created_at);
+
+-- Index tags in chirps written before this migration.
+INSERT INTO hashtags (id, tag, created_at)
+SELECT gen_random_uuid(), tag, NOW()
+FROM (
+    SELECT DISTINCT lower(m[1]) AS tag
+    FROM chirps, regexp_matches(body, '(?:^|[^[:alnum:]_])#([[:alnum:]_]*[[:alpha:]][[:alnum:]_]*)', 'g') AS m
+) AS tags;
+
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+SELECT DISTINCT chirps.id, hashtags.id, chirps.created_at
+FROM chirps, regexp_matches(chirps.body, '(?:^|[^[:alnum:]_])#([[:alnum:]_]*[[:alpha:]][[:alnum:]_]*)', 'g') AS m
+JOIN hashtags ON hashtags.tag = lower(m[1]);
+
+-- +goose Down
+DROP TABLE IF EXISTS chirp_hashtags;
+DROP TABLE IF EXISTS hashtags;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN handle TEXT;
+
+-- Give existing accounts a handle derived from their email. The id suffix
+-- keeps them unique; users can pick a nicer one through PUT /api/users.
+UPDATE users
+SET handle = left(lower(regexp_replace(split_part(email, '@', 1), '[^A-Za-z0-9_]', '_', 'g')), 20)
+    || '_' || substr(replace(id::text, '-', ''), 1, 8);
+
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_handle_key UNIQUE (handle);
+
+-- handle records how the user was addressed when the chirp was written, so
+-- mentions keep pointing at the right account after a handle change.
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    handle TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE INDEX chirp_mentions_user_id_created_at_idx ON chirp_mentions (user_id, created_at, chirp_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS chirp_mentions;
+ALTER TABLE users DROP COLUMN handle;
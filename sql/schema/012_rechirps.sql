@@ -0,0 +1,16 @@
+-- +goose Up
+-- A plain rechirp has an empty body and only exists to share rechirp_of, so
+-- it goes away with the original. A quote has its own body and survives.
+ALTER TABLE chirps ADD COLUMN rechirp_of UUID REFERENCES chirps(id) ON DELETE CASCADE;
+ALTER TABLE chirps ADD COLUMN quote_of UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+ALTER TABLE chirps ADD CONSTRAINT chirps_user_id_rechirp_of_key UNIQUE (user_id, rechirp_of);
+CREATE INDEX chirps_rechirp_of_idx ON chirps (rechirp_of);
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of);
+
+-- +goose Down
+DROP INDEX IF EXISTS chirps_quote_of_idx;
+DROP INDEX IF EXISTS chirps_rechirp_of_idx;
+ALTER TABLE chirps DROP CONSTRAINT IF EXISTS chirps_user_id_rechirp_of_key;
+ALTER TABLE chirps DROP COLUMN quote_of;
+ALTER TABLE chirps DROP COLUMN rechirp_of;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- The primary key leads with chirp_id so like counts for a page of chirps
+-- are answered from the index.
+CREATE TABLE chirp_likes (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE UNIQUE INDEX chirp_likes_user_id_chirp_id_idx ON chirp_likes (user_id, chirp_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS chirp_likes;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_tokens_user_id_idx;
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS user_agent;
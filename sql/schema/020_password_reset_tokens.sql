@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX password_reset_tokens_user_id_created_at_idx ON password_reset_tokens (user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS password_reset_tokens;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- The shared secret, encrypted like the token signing keys.
+    secret BYTEA NOT NULL,
+    -- Set once the user proves their authenticator works; until then the
+    -- enrollment is pending and login is unaffected.
+    confirmed_at TIMESTAMP,
+    -- The last time step a code was accepted for, so codes can't be replayed.
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE recovery_codes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP,
+    locked_until TIMESTAMP
+);
+
+CREATE TABLE login_lockouts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    locked_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_lockouts_locked_at_idx ON login_lockouts (locked_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_throttles;
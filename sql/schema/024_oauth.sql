@@ -0,0 +1,53 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- NULL for public clients, such as mobile apps, that can't keep a
+    -- secret and rely on PKCE alone.
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    -- The most a user can grant the client.
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients (owner_id);
+
+CREATE TABLE oauth_consents (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    -- The refresh token family the code is exchanged for, chosen up front
+    -- so a replayed code can revoke what it was exchanged for.
+    family_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- Refresh tokens issued to OAuth clients name the client and carry the
+-- granted scopes; both are NULL for a user's own sessions.
+ALTER TABLE refresh_tokens
+    ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    ADD COLUMN scopes TEXT[];
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS client_id;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+        CHECK (role IN ('user', 'moderator', 'admin')),
+    ADD COLUMN suspended_at TIMESTAMP;
+
+CREATE INDEX users_created_at_id_idx ON users (created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS users_created_at_id_idx;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS suspended_at,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,45 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'suspended', 'banned')),
+    ADD COLUMN status_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN suspended_until TIMESTAMP,
+    ADD COLUMN chirps_hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD CONSTRAINT users_suspended_until_check
+        CHECK ((status = 'suspended') = (suspended_until IS NOT NULL));
+
+-- Suspensions used to be open-ended, which is what a ban is now.
+UPDATE users
+SET status = 'banned', status_reason = 'Suspended before account states were recorded'
+WHERE suspended_at IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN suspended_at;
+
+CREATE TABLE account_status_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    suspended_until TIMESTAMP,
+    chirps_hidden BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX account_status_events_user_id_idx ON account_status_events (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS account_status_events;
+
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+
+UPDATE users
+SET suspended_at = NOW()
+WHERE status = 'banned' OR (status = 'suspended' AND suspended_until > NOW());
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_suspended_until_check,
+    DROP COLUMN IF EXISTS chirps_hidden,
+    DROP COLUMN IF EXISTS suspended_until,
+    DROP COLUMN IF EXISTS status_reason,
+    DROP COLUMN IF EXISTS status;
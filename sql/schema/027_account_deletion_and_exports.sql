@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX users_deletion_scheduled_at_idx ON users (deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
+
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'ready', 'failed')),
+    archive BYTEA,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS data_exports;
+DROP INDEX IF EXISTS users_deletion_scheduled_at_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
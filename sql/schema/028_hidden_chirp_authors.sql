@@ -0,0 +1,12 @@
+-- +goose Up
+-- Users whose chirps nobody else may see: those banned, or suspended until
+-- a time still to come, with their chirps hidden. Every query that shows
+-- chirps filters on this one definition.
+CREATE VIEW hidden_chirp_authors AS
+SELECT id
+FROM users
+WHERE chirps_hidden
+AND (status = 'banned' OR (status = 'suspended' AND suspended_until > NOW()));
+
+-- +goose Down
+DROP VIEW IF EXISTS hidden_chirp_authors;
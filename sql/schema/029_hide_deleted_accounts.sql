@@ -0,0 +1,17 @@
+-- +goose Up
+-- Accounts waiting out their deletion grace period are hidden too.
+CREATE OR REPLACE VIEW hidden_chirp_authors AS
+SELECT id
+FROM users
+WHERE deletion_scheduled_at IS NOT NULL
+OR (
+    chirps_hidden
+    AND (status = 'banned' OR (status = 'suspended' AND suspended_until > NOW()))
+);
+
+-- +goose Down
+CREATE OR REPLACE VIEW hidden_chirp_authors AS
+SELECT id
+FROM users
+WHERE chirps_hidden
+AND (status = 'banned' OR (status = 'suspended' AND suspended_until > NOW()));
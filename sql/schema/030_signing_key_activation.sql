@@ -0,0 +1,9 @@
+-- +goose Up
+-- New keys are published before they sign, so every instance and any
+-- verifier caching the key set knows them first.
+ALTER TABLE signing_keys ADD COLUMN activates_at TIMESTAMP;
+UPDATE signing_keys SET activates_at = created_at;
+ALTER TABLE signing_keys ALTER COLUMN activates_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE signing_keys DROP COLUMN activates_at;
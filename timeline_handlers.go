@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerGetHomeTimeline serves the caller's own chirps merged with those of
+// everyone they follow, newest first.
+func (cfg *apiConfig) handlerGetHomeTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.authorize(w, r, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r.URL.Query(), sortDesc, sortAsc)
+	if err != nil {
+		sendJSONResponse(w, ErrorResponse{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	cursorCreatedAt, cursorID := page.cursorParams()
+
+	var dbChirps []database.Chirp
+	if page.descending() {
+		dbChirps, err = cfg.db.ListHomeTimelineDesc(r.Context(), database.ListHomeTimelineDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+	} else {
+		dbChirps, err = cfg.db.ListHomeTimelineAsc(r.Context(), database.ListHomeTimelineAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           page.fetchLimit(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error retrieving timeline: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirps"}, http.StatusInternalServerError)
+		return
+	}
+
+	dbChirps, next, prev := paginate(page, dbChirps, databaseChirpCursor)
+
+	chirps, err := cfg.loadChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, dbChirps)
+	if err != nil {
+		log.Printf("Error loading chirps: %s", err)
+		sendJSONResponse(w, ErrorResponse{Error: "Failed to retrieve chirps"}, http.StatusInternalServerError)
+		return
+	}
+
+	setPaginationLinks(w, r, next, prev)
+	sendJSONResponse(w, chirps, http.StatusOK)
+}
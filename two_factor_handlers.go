@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SethGK/chirpy/internal/auth"
+	"github.com/SethGK/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// mfaChallengeDuration is how long a password login stays good for
+	// while the user fetches their second factor.
+	mfaChallengeDuration = 5 * time.Minute
+	recoveryCodeCount    = 10
+	totpIssuer           = "Chirpy"
+)
+
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// issueRecoveryCodes replaces userID's recovery codes with a fresh set and
+// returns them. Only their hashes are stored, so this is the one time they
+// can be shown.
+func issueRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// verifySecondFactor checks code, either a current TOTP code or an unused
+// recovery code, for a user with confirmed two-factor authentication. A
+// code that verifies is spent and won't verify again.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !totp.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	if len(code) != auth.TOTPDigits {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		return used == 1, err
+	}
+
+	secret, err := auth.Open(totp.Secret, cfg.jwtSecret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := auth.ValidateTOTP(string(secret), code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+	// Advancing the step only if nobody else did keeps two concurrent
+	// requests from spending the same code.
+	advanced, err := cfg.db.AdvanceTOTPStep(ctx, database.AdvanceTOTPStepParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	return advanced == 1, err
+}
+
+func (cfg *apiConfig) handlerGetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Enabled                bool  `json:"enabled"`
+		Pending                bool  `json:"pending"`
+		RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		sendJSONResponse(w, response{}, http.StatusOK)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve two-factor status", err)
+		return
+	}
+
+	remaining, err := cfg.db.CountUnusedRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve two-factor status", err)
+		return
+	}
+
+	sendJSONResponse(w, response{
+		Enabled:                totp.ConfirmedAt.Valid,
+		Pending:                !totp.ConfirmedAt.Valid,
+		RecoveryCodesRemaining: remaining,
+	}, http.StatusOK)
+}
+
+// handlerEnrollTOTP starts enrollment with a new secret. Two-factor
+// authentication isn't enforced until the user confirms a code from it.
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate secret", err)
+		return
+	}
+	sealed, err := auth.Seal([]byte(secret), cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate secret", err)
+		return
+	}
+
+	stored, err := cfg.db.UpsertPendingTOTP(r.Context(), database.UpsertPendingTOTPParams{
+		UserID: userID,
+		Secret: sealed,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save secret", err)
+		return
+	}
+	if stored == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	sendJSONResponse(w, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	}, http.StatusOK)
+}
+
+// handlerConfirmTOTP enables two-factor authentication once the user shows
+// a code from their authenticator, and hands out recovery codes.
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userID)
+	if err == sql.ErrNoRows || (err == nil && totp.ConfirmedAt.Valid) {
+		respondWithError(w, http.StatusConflict, "No two-factor enrollment is pending", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve enrollment", err)
+		return
+	}
+
+	secret, err := auth.Open(totp.Secret, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve enrollment", err)
+		return
+	}
+	step, ok := auth.ValidateTOTP(string(secret), params.Code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", nil)
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	confirmed, err := qtx.ConfirmUserTOTP(r.Context(), database.ConfirmUserTOTPParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+	if confirmed == 0 {
+		respondWithError(w, http.StatusConflict, "No two-factor enrollment is pending", nil)
+		return
+	}
+
+	codes, err := issueRecoveryCodes(r.Context(), qtx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	sendJSONResponse(w, recoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// handlerRegenerateRecoveryCodes replaces the user's recovery codes, which
+// requires a current second factor.
+func (cfg *apiConfig) handlerRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	// Wrong codes count as failed logins, as at /api/login/mfa, so a stolen
+	// access token can't be used to guess them.
+	account := loginAccount(user.Email)
+	if !cfg.reserveLoginAttempt(w, r, account) {
+		return
+	}
+
+	verified, err := cfg.verifySecondFactor(r.Context(), userID, params.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify code", err)
+		return
+	}
+	if !verified {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", nil)
+		return
+	}
+	cfg.releaseLoginAttempt(r, account)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := issueRecoveryCodes(r.Context(), cfg.db.WithTx(tx), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	sendJSONResponse(w, recoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// handlerDisableTOTP turns two-factor authentication off. It takes both
+// the password and a second factor, so a stolen access token alone can't
+// weaken the account.
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	userID, _, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve user", err)
+		return
+	}
+
+	// The password and code together are one login attempt, throttled like
+	// any other.
+	account := loginAccount(user.Email)
+	if !cfg.reserveLoginAttempt(w, r, account) {
+		return
+	}
+	if _, err := cfg.passwords.Verify(params.Password, user.HashedPassword); err != nil {
+		respondWithError(w, http.StatusForbidden, "Incorrect password", nil)
+		return
+	}
+
+	verified, err := cfg.verifySecondFactor(r.Context(), userID, params.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify code", err)
+		return
+	}
+	if !verified {
+		respondWithError(w, http.StatusBadRequest, "Invalid code", nil)
+		return
+	}
+	cfg.releaseLoginAttempt(r, account)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.DeleteUserTOTP(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLoginMFA completes a login that handlerLogin answered with an MFA
+// challenge.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+
+	claims, err := auth.ParseMFAChallengeJWT(params.MFAToken, cfg.jwtKeys)
+	if err != nil {
+		message := "Invalid MFA token"
+		if errors.Is(err, auth.ErrTokenExpired) {
+			message = "MFA token has expired, log in again"
+		}
+		respondWithError(w, http.StatusUnauthorized, message, nil)
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid MFA token", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid MFA token", nil)
+		return
+	}
+	if restriction := restrictionOf(user.Status, user.StatusReason, user.SuspendedUntil, time.Now().UTC()); restriction != nil {
+		respondAccountRestricted(w, restriction)
+		return
+	}
+
+	// Wrong codes count as failed logins, so the six digits can't be
+	// guessed within one challenge's lifetime.
+	account := loginAccount(user.Email)
+	if !cfg.reserveLoginAttempt(w, r, account) {
+		return
+	}
+
+	verified, err := cfg.verifySecondFactor(r.Context(), userID, params.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify code", err)
+		return
+	}
+	if !verified {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code", nil)
+		return
+	}
+
+	cfg.releaseLoginAttempt(r, account)
+	cfg.recordLoginSuccess(r, account)
+	cfg.startSession(w, r, user)
+}
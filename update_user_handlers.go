@@ -3,36 +3,34 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/SethGK/chirpy/internal/auth"
 	"github.com/SethGK/chirpy/internal/database"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type updateUserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Handle   string `json:"handle"`
 }
 
 type updateUserResponse struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
+	Handle    string    `json:"handle"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// EmailVerified is false after a change of address until the new
+	// address is verified.
+	EmailVerified bool `json:"email_verified"`
 }
 
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Missing or invalid access token", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid or expired token", err)
+	userID, claims, ok := cfg.authorize(w, r, auth.ScopeProfileWrite)
+	if !ok {
 		return
 	}
 
@@ -48,31 +46,107 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if req.Email == "" || req.Password == "" {
+	// Delegated tokens leave the password out: they only edit the profile.
+	if req.Email == "" || (req.Password == "" && claims.FullAccess()) {
 		respondWithError(w, http.StatusBadRequest, "Email and password are required", errors.New("missing fields"))
 		return
 	}
+	// Nor may they touch the credentials that would let their holder take
+	// over the account. Any password is refused without looking at it, as
+	// comparing it with the current one would tell them if a guess was
+	// right.
+	if !claims.FullAccess() && (req.Password != "" || req.Email != user.Email) {
+		respondWithError(w, http.StatusForbidden, "Sign in to change your email or password", nil)
+		return
+	}
+	if err := validateEmail(req.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+		return
+	}
+
+	handle := user.Handle
+	if req.Handle != "" {
+		handle, err = normalizeHandle(req.Handle)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid handle", err)
+			return
+		}
+	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword := user.HashedPassword
+	passwordChanged := false
+	if req.Password != "" {
+		// Compare against the stored hash before it's replaced; a mismatch
+		// is a new password. Delegated tokens were turned away above, so
+		// only signed-in sessions get here and it isn't throttled like a
+		// login.
+		_, err = cfg.passwords.Verify(req.Password, user.HashedPassword)
+		passwordChanged = err != nil
+		// Only a new password has to meet the policy, so users with
+		// passwords from before it can still edit their profile.
+		if passwordChanged && !cfg.checkPassword(w, req.Password, req.Email) {
+			return
+		}
+
+		hashedPassword, err = cfg.passwords.Hash(req.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
+			return
+		}
+	}
+
+	// The new password and the sign-out of other devices land together.
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	updatedUser, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
+	updatedUser, err := qtx.UpdateUser(r.Context(), database.UpdateUserParams{
 		Email:          req.Email,
-		HashedPassword: string(hashedPassword),
+		HashedPassword: hashedPassword,
+		Handle:         handle,
 		ID:             user.ID,
 	})
 	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Email or handle already in use", err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
 		return
 	}
 
+	// A new password signs out every other device.
+	if passwordChanged {
+		_, err = qtx.RevokeOtherUserSessions(r.Context(), database.RevokeOtherUserSessionsParams{
+			UserID:       user.ID,
+			KeepFamilyID: claims.Session(),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user", err)
+		return
+	}
+
+	if updatedUser.Email != user.Email {
+		if err := cfg.sendVerificationEmail(r.Context(), updatedUser.ID, updatedUser.Email); err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+	}
+
 	respondWithJSON(w, http.StatusOK, updateUserResponse{
-		ID:        updatedUser.ID.String(),
-		Email:     updatedUser.Email,
-		CreatedAt: updatedUser.CreatedAt,
-		UpdatedAt: updatedUser.UpdatedAt,
+		ID:            updatedUser.ID.String(),
+		Email:         updatedUser.Email,
+		Handle:        updatedUser.Handle,
+		CreatedAt:     updatedUser.CreatedAt,
+		UpdatedAt:     updatedUser.UpdatedAt,
+		EmailVerified: updatedUser.EmailVerifiedAt.Valid,
 	})
 }
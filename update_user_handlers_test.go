@@ -0,0 +1,42 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChangingPasswordDoesNotThrottleLogin(t *testing.T) {
+	db := newFakeDB()
+	cfg := newTestConfig(t, db)
+	user := addTestUser(t, cfg, db)
+	db.setRows("UpdateUser", []driver.Value{
+		user.ID.String(), user.Email, user.Handle, user.CreatedAt, user.UpdatedAt, nil,
+	})
+	token := sessionToken(t, cfg, user)
+
+	for i := 0; i < accountLoginPolicy.LockoutThreshold+1; i++ {
+		body := fmt.Sprintf(`{"email":%q,"password":"new password number %d"}`, user.Email, i)
+		req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		cfg.handlerUpdateUser(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("change %d: status = %d, want %d: %s", i, w.Code, http.StatusOK, w.Body)
+		}
+	}
+	if changes := db.argsOf("RevokeOtherUserSessions"); len(changes) != accountLoginPolicy.LockoutThreshold+1 {
+		t.Errorf("other sessions were signed out %d times, want after every change", len(changes))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login",
+		strings.NewReader(`{"email":"`+user.Email+`","password":"`+testPassword+`"}`))
+	w := httptest.NewRecorder()
+	cfg.handlerLogin(w, req)
+	if w.Code == http.StatusTooManyRequests {
+		t.Fatal("password changes counted as failed logins")
+	}
+}